@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/fatih/structs"
+	"github.com/satori/go.uuid"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"strings"
+)
+
+const (
+	// clientTypeSPA is a public browser client using the code flow with PKCE.
+	clientTypeSPA = "spa"
+	// clientTypeCLI is a public client for the awsci CLI, which logs in
+	// directly or through a localhost callback.
+	clientTypeCLI = "cli"
+	// clientTypeBackend is a confidential client with a secret, using the
+	// client credentials grant.
+	clientTypeBackend = "backend"
+)
+
+// appClient describes one app client of a Custom::CognitoAppClients resource.
+// Access and ID token validities are in minutes, refresh token validity in days.
+type appClient struct {
+	Name                 string   `json:"Name"`
+	Type                 string   `json:"Type"`
+	Scopes               []string `json:"Scopes"`
+	CallbackUrls         []string `json:"CallbackUrls"`
+	LogoutUrls           []string `json:"LogoutUrls"`
+	AccessTokenValidity  int64    `json:"AccessTokenValidity,string"`
+	IdTokenValidity      int64    `json:"IdTokenValidity,string"`
+	RefreshTokenValidity int64    `json:"RefreshTokenValidity,string"`
+}
+
+// appClientsProperties are the properties of a Custom::CognitoAppClients resource.
+type appClientsProperties struct {
+	UserPoolId string      `json:"UserPoolId"`
+	Clients    []appClient `json:"Clients"`
+}
+
+// appClientsHandler creates and owns the app clients of the user pool. Client
+// ids are kept in SSM below /cognito/clients/<name>/, along with the secret of
+// confidential clients as a SecureString.
+type appClientsHandler struct {
+	cognito cognitoidentityprovideriface.CognitoIdentityProviderAPI
+	ssm     ssmiface.SSMAPI
+}
+
+func clientParameter(name, key string) string {
+	return fmt.Sprintf("/cognito/clients/%s/%s", name, key)
+}
+
+func (c *appClient) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("app client Name is required")
+	}
+
+	switch c.Type {
+	case clientTypeSPA, clientTypeCLI, clientTypeBackend:
+	default:
+		return fmt.Errorf("unsupported Type %s for app client %s", c.Type, c.Name)
+	}
+
+	return nil
+}
+
+// settings returns the flows, scopes and token validities of the client as
+// an UpdateUserPoolClientInput, which Create copies from as well.
+func (c *appClient) settings(userPoolId string) *cognito.UpdateUserPoolClientInput {
+	input := &cognito.UpdateUserPoolClientInput{
+		UserPoolId:                 aws.String(userPoolId),
+		ClientName:                 aws.String(c.Name),
+		AllowedOAuthScopes:         aws.StringSlice(c.Scopes),
+		CallbackURLs:               aws.StringSlice(c.CallbackUrls),
+		LogoutURLs:                 aws.StringSlice(c.LogoutUrls),
+		SupportedIdentityProviders: []*string{aws.String("COGNITO")},
+		PreventUserExistenceErrors: aws.String(cognito.PreventUserExistenceErrorTypesEnabled),
+		TokenValidityUnits: &cognito.TokenValidityUnitsType{
+			AccessToken:  aws.String(cognito.TimeUnitsTypeMinutes),
+			IdToken:      aws.String(cognito.TimeUnitsTypeMinutes),
+			RefreshToken: aws.String(cognito.TimeUnitsTypeDays),
+		},
+	}
+
+	if c.AccessTokenValidity > 0 {
+		input.AccessTokenValidity = aws.Int64(c.AccessTokenValidity)
+	}
+	if c.IdTokenValidity > 0 {
+		input.IdTokenValidity = aws.Int64(c.IdTokenValidity)
+	}
+	if c.RefreshTokenValidity > 0 {
+		input.RefreshTokenValidity = aws.Int64(c.RefreshTokenValidity)
+	}
+
+	switch c.Type {
+	case clientTypeSPA:
+		// Public clients without a secret get PKCE support on the code flow
+		input.ExplicitAuthFlows = aws.StringSlice([]string{
+			cognito.ExplicitAuthFlowsTypeAllowUserSrpAuth,
+			cognito.ExplicitAuthFlowsTypeAllowRefreshTokenAuth,
+		})
+		input.AllowedOAuthFlows = aws.StringSlice([]string{cognito.OAuthFlowTypeCode})
+		input.AllowedOAuthFlowsUserPoolClient = aws.Bool(true)
+	case clientTypeCLI:
+		input.ExplicitAuthFlows = aws.StringSlice([]string{
+			cognito.ExplicitAuthFlowsTypeAllowUserPasswordAuth,
+			cognito.ExplicitAuthFlowsTypeAllowCustomAuth,
+			cognito.ExplicitAuthFlowsTypeAllowRefreshTokenAuth,
+		})
+		if len(c.CallbackUrls) > 0 {
+			input.AllowedOAuthFlows = aws.StringSlice([]string{cognito.OAuthFlowTypeCode})
+			input.AllowedOAuthFlowsUserPoolClient = aws.Bool(true)
+		}
+	case clientTypeBackend:
+		input.ExplicitAuthFlows = aws.StringSlice([]string{cognito.ExplicitAuthFlowsTypeAllowRefreshTokenAuth})
+		input.AllowedOAuthFlows = aws.StringSlice([]string{cognito.OAuthFlowTypeClientCredentials})
+		input.AllowedOAuthFlowsUserPoolClient = aws.Bool(true)
+		input.SupportedIdentityProviders = nil
+	}
+
+	return input
+}
+
+func (h *appClientsHandler) Create(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	props := &appClientsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	for _, client := range props.Clients {
+		if err = client.validate(); err != nil {
+			return
+		}
+	}
+
+	rollback := cfnresource.NewRollback(request.Log)
+
+	data = map[string]interface{}{}
+	for _, client := range props.Clients {
+		clientId := ""
+		clientId, err = h.createClient(ctx, request.Log, props.UserPoolId, client, rollback)
+		if err != nil {
+			err = rollback.Run(err)
+			return
+		}
+		data[client.Name+"ClientId"] = clientId
+	}
+
+	physicalResourceID = fmt.Sprintf("%s-%s", request.LogicalResourceID, uuid.NewV4().String())
+
+	return
+}
+
+func (h *appClientsHandler) Update(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &appClientsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	oldProps := &appClientsProperties{}
+	if err = request.DecodeOldProperties(oldProps); err != nil {
+		return
+	}
+
+	for _, client := range props.Clients {
+		if err = client.validate(); err != nil {
+			return
+		}
+	}
+
+	physicalResourceID = request.PhysicalResourceID
+
+	oldClients := map[string]appClient{}
+	if oldProps.UserPoolId == props.UserPoolId {
+		for _, client := range oldProps.Clients {
+			oldClients[client.Name] = client
+		}
+	}
+
+	data = map[string]interface{}{}
+	for _, client := range props.Clients {
+		old, existed := oldClients[client.Name]
+		delete(oldClients, client.Name)
+
+		// Whether a client has a secret can't be changed, so switching between
+		// public and confidential replaces it
+		if existed && (old.Type == clientTypeBackend) != (client.Type == clientTypeBackend) {
+			if err = h.deleteClient(ctx, log, props.UserPoolId, old); err != nil {
+				return
+			}
+			existed = false
+		}
+
+		clientId := ""
+		if existed {
+			clientId, err = h.updateClient(ctx, log, props.UserPoolId, client)
+		} else {
+			created := cfnresource.NewRollback(log)
+			clientId, err = h.createClient(ctx, log, props.UserPoolId, client, created)
+			if err != nil {
+				err = created.Run(err)
+			}
+		}
+		if err != nil {
+			return
+		}
+		data[client.Name+"ClientId"] = clientId
+	}
+
+	// Clients dropped from the template, or all of them when the resource moved
+	// to another user pool
+	var errs error
+	removed := oldClients
+	if oldProps.UserPoolId != props.UserPoolId {
+		removed = map[string]appClient{}
+		for _, client := range oldProps.Clients {
+			removed[client.Name] = client
+		}
+	}
+	for _, client := range removed {
+		errs = multierr.Append(errs, h.deleteClient(ctx, log, oldProps.UserPoolId, client))
+	}
+
+	err = errs
+
+	return
+}
+
+func (h *appClientsHandler) Delete(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	physicalResourceID = request.PhysicalResourceID
+
+	props := &appClientsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	// A Create that failed reports the log stream name as its physical
+	// resource id, the parameters then name clients of another resource
+	if !strings.HasPrefix(request.PhysicalResourceID, request.LogicalResourceID+"-") {
+		request.Log.Infow("resource was not created by this function, skipping delete", "PhysicalResourceID", request.PhysicalResourceID)
+		data = map[string]interface{}{
+			"message": "custom resource not found",
+		}
+		return
+	}
+
+	var errs error
+	for _, client := range props.Clients {
+		errs = multierr.Append(errs, h.deleteClient(ctx, request.Log, props.UserPoolId, client))
+	}
+
+	err = errs
+
+	return
+}
+
+// createClient creates the client and publishes its id, adding the undo to
+// rollback as soon as the client exists, so a failure to publish the id
+// doesn't leave a client behind that nothing can find.
+func (h *appClientsHandler) createClient(ctx context.Context, log *zap.SugaredLogger, userPoolId string, client appClient, rollback *cfnresource.Rollback) (string, error) {
+	settings := client.settings(userPoolId)
+
+	createClientRequest := &cognito.CreateUserPoolClientInput{
+		UserPoolId:                      settings.UserPoolId,
+		ClientName:                      settings.ClientName,
+		GenerateSecret:                  aws.Bool(client.Type == clientTypeBackend),
+		AccessTokenValidity:             settings.AccessTokenValidity,
+		IdTokenValidity:                 settings.IdTokenValidity,
+		RefreshTokenValidity:            settings.RefreshTokenValidity,
+		TokenValidityUnits:              settings.TokenValidityUnits,
+		ExplicitAuthFlows:               settings.ExplicitAuthFlows,
+		SupportedIdentityProviders:      settings.SupportedIdentityProviders,
+		CallbackURLs:                    settings.CallbackURLs,
+		LogoutURLs:                      settings.LogoutURLs,
+		AllowedOAuthFlows:               settings.AllowedOAuthFlows,
+		AllowedOAuthScopes:              settings.AllowedOAuthScopes,
+		AllowedOAuthFlowsUserPoolClient: settings.AllowedOAuthFlowsUserPoolClient,
+		PreventUserExistenceErrors:      settings.PreventUserExistenceErrors,
+	}
+
+	log.Infow("Cognito CreateUserPoolClient Request", "Request", structs.Map(createClientRequest))
+
+	createClientResponse, err := h.cognito.CreateUserPoolClientWithContext(ctx, createClientRequest)
+	if err != nil {
+		log.Errorw("Cognito CreateUserPoolClient Error", "Error", err)
+		return "", err
+	}
+
+	userPoolClient := createClientResponse.UserPoolClient
+
+	log.Infow("Cognito CreateUserPoolClient Response", "ClientName", client.Name, "ClientId", userPoolClient.ClientId)
+
+	clientId := *userPoolClient.ClientId
+	rollback.Add("CreateUserPoolClient "+client.Name, func() error {
+		return h.removeClient(ctx, log, userPoolId, client, clientId)
+	})
+
+	if err := h.putParameter(ctx, log, clientParameter(client.Name, "id"), *userPoolClient.ClientId, ssm.ParameterTypeString); err != nil {
+		return "", err
+	}
+
+	if userPoolClient.ClientSecret != nil {
+		if err := h.putParameter(ctx, log, clientParameter(client.Name, "secret"), *userPoolClient.ClientSecret, ssm.ParameterTypeSecureString); err != nil {
+			return "", err
+		}
+	}
+
+	if err := h.putAllowlists(ctx, log, client); err != nil {
+		return "", err
+	}
+
+	return *userPoolClient.ClientId, nil
+}
+
+// putAllowlists publishes where the API may send the client's users after
+// signing in and out. Empty lists are deleted, SSM has no empty values.
+func (h *appClientsHandler) putAllowlists(ctx context.Context, log *zap.SugaredLogger, client appClient) error {
+	empty := []string{}
+
+	for _, allowlist := range []struct {
+		key  string
+		uris []string
+	}{
+		{"redirectUris", client.CallbackUrls},
+		{"logoutUris", client.LogoutUrls},
+	} {
+		name := clientParameter(client.Name, allowlist.key)
+		if len(allowlist.uris) == 0 {
+			empty = append(empty, name)
+			continue
+		}
+		if err := h.putParameter(ctx, log, name, strings.Join(allowlist.uris, ","), ssm.ParameterTypeStringList); err != nil {
+			return err
+		}
+	}
+
+	if len(empty) == 0 {
+		return nil
+	}
+
+	deleteParametersRequest := &ssm.DeleteParametersInput{
+		Names: aws.StringSlice(empty),
+	}
+
+	log.Infow("SSM DeleteParameters Request", "Request", structs.Map(deleteParametersRequest))
+
+	deleteParametersResponse, err := h.ssm.DeleteParametersWithContext(ctx, deleteParametersRequest)
+	if err != nil {
+		log.Errorw("SSM DeleteParameters Error", "Error", err)
+		return err
+	}
+
+	log.Infow("SSM DeleteParameters Response", "Response", structs.Map(deleteParametersResponse))
+
+	return nil
+}
+
+func (h *appClientsHandler) updateClient(ctx context.Context, log *zap.SugaredLogger, userPoolId string, client appClient) (string, error) {
+	clientId, err := h.clientId(ctx, log, client.Name)
+	if err != nil {
+		return "", err
+	}
+
+	updateClientRequest := client.settings(userPoolId)
+	updateClientRequest.ClientId = aws.String(clientId)
+
+	// Federated providers are enabled on the client by their own resources,
+	// an update mustn't drop them
+	if updateClientRequest.SupportedIdentityProviders != nil {
+		unlock, err := lockClient(ctx, log, h.ssm, clientId)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+
+		providers, err := supportedProviders(ctx, log, h.cognito, userPoolId, clientId)
+		if err != nil {
+			return "", err
+		}
+		updateClientRequest.SupportedIdentityProviders = providers
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Request", "Request", structs.Map(updateClientRequest))
+
+	updateClientResponse, err := h.cognito.UpdateUserPoolClientWithContext(ctx, updateClientRequest)
+	if err != nil {
+		log.Errorw("Cognito UpdateUserPoolClient Error", "Error", err)
+		return "", err
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Response", "ClientName", client.Name, "ClientId", updateClientResponse.UserPoolClient.ClientId)
+
+	if err = h.putAllowlists(ctx, log, client); err != nil {
+		return "", err
+	}
+
+	return clientId, nil
+}
+
+// deleteClient removes the client and its parameters, treating anything that
+// is already gone as deleted.
+func (h *appClientsHandler) deleteClient(ctx context.Context, log *zap.SugaredLogger, userPoolId string, client appClient) error {
+	clientId, err := h.clientId(ctx, log, client.Name)
+	switch {
+	case err != nil && !isParameterNotFound(err):
+		return multierr.Append(err, h.removeClient(ctx, log, userPoolId, client, ""))
+	case err != nil:
+		log.Warnw("app client id not found, skipping client deletion", "ClientName", client.Name)
+		clientId = ""
+	}
+
+	return h.removeClient(ctx, log, userPoolId, client, clientId)
+}
+
+// removeClient deletes the client clientId, if there is one, and the
+// parameters published for it.
+func (h *appClientsHandler) removeClient(ctx context.Context, log *zap.SugaredLogger, userPoolId string, client appClient, clientId string) error {
+	var errs error
+
+	if clientId != "" {
+		deleteClientRequest := &cognito.DeleteUserPoolClientInput{
+			UserPoolId: aws.String(userPoolId),
+			ClientId:   aws.String(clientId),
+		}
+
+		log.Infow("Cognito DeleteUserPoolClient Request", "Request", structs.Map(deleteClientRequest))
+
+		_, err := h.cognito.DeleteUserPoolClientWithContext(ctx, deleteClientRequest)
+		switch {
+		case err != nil && !isNotFound(err):
+			log.Errorw("Cognito DeleteUserPoolClient Error", "Error", err)
+			errs = multierr.Append(errs, err)
+		case err != nil:
+			log.Warnw("Cognito app client already deleted", "ClientName", client.Name)
+		default:
+			log.Infow("Cognito DeleteUserPoolClient Response", "ClientName", client.Name)
+		}
+	}
+
+	deleteParametersRequest := &ssm.DeleteParametersInput{
+		Names: aws.StringSlice([]string{
+			clientParameter(client.Name, "id"),
+			clientParameter(client.Name, "secret"),
+			clientParameter(client.Name, "redirectUris"),
+			clientParameter(client.Name, "logoutUris"),
+		}),
+	}
+
+	log.Infow("SSM DeleteParameters Request", "Request", structs.Map(deleteParametersRequest))
+
+	deleteParametersResponse, err := h.ssm.DeleteParametersWithContext(ctx, deleteParametersRequest)
+	if err != nil {
+		log.Errorw("SSM DeleteParameters Error", "Error", err)
+		errs = multierr.Append(errs, err)
+	} else {
+		log.Infow("SSM DeleteParameters Response", "Response", structs.Map(deleteParametersResponse))
+	}
+
+	return errs
+}
+
+func (h *appClientsHandler) clientId(ctx context.Context, log *zap.SugaredLogger, name string) (string, error) {
+	getParameterRequest := &ssm.GetParameterInput{
+		Name: aws.String(clientParameter(name, "id")),
+	}
+
+	log.Infow("SSM GetParameter Request", "Request", structs.Map(getParameterRequest))
+
+	getParameterResponse, err := h.ssm.GetParameterWithContext(ctx, getParameterRequest)
+	if err != nil {
+		log.Errorw("SSM GetParameter Error", "Error", err)
+		return "", err
+	}
+
+	return *getParameterResponse.Parameter.Value, nil
+}
+
+func (h *appClientsHandler) putParameter(ctx context.Context, log *zap.SugaredLogger, name, value, parameterType string) error {
+	putParameterRequest := &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      aws.String(parameterType),
+		Overwrite: aws.Bool(true),
+	}
+
+	// Don't log the value, it may be a client secret
+	log.Infow("SSM PutParameter Request", "Name", name, "Type", parameterType)
+
+	_, err := h.ssm.PutParameterWithContext(ctx, putParameterRequest)
+	if err != nil {
+		log.Errorw("SSM PutParameter Error", "Error", err)
+		return err
+	}
+
+	return nil
+}
+
+func isParameterNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == ssm.ErrCodeParameterNotFound
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/fatih/structs"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// clientLockPrefix names the SSM parameters that serialize changes to
+	// the provider list of an app client.
+	clientLockPrefix = "/cognito/locks/client/"
+
+	// clientLockTimeout is how long a lock may be held before it is taken
+	// to be left behind by an invocation that died.
+	clientLockTimeout = 2 * time.Minute
+	clientLockRetry   = time.Second
+)
+
+// supportedProviders returns the identity providers currently enabled on the
+// app client, so that updating other client settings doesn't drop them.
+func supportedProviders(ctx context.Context, log *zap.SugaredLogger, svc cognitoidentityprovideriface.CognitoIdentityProviderAPI, userPoolId, clientId string) ([]*string, error) {
+	client, err := describeClient(ctx, log, svc, userPoolId, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []*string{aws.String("COGNITO")}
+	for _, provider := range client.SupportedIdentityProviders {
+		if *provider != "COGNITO" {
+			providers = append(providers, provider)
+		}
+	}
+
+	return providers, nil
+}
+
+// lockClient takes the lock on the provider list of the app client.
+// CloudFormation creates sibling providers in parallel, and Cognito has no
+// conditional updates, so their read-modify-write would otherwise race.
+func lockClient(ctx context.Context, log *zap.SugaredLogger, ssmSvc ssmiface.SSMAPI, clientId string) (unlock func(), err error) {
+	name := clientLockPrefix + clientId
+
+	for {
+		_, err = ssmSvc.PutParameterWithContext(ctx, &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(time.Now().UTC().Format(time.RFC3339)),
+			Type:      aws.String(ssm.ParameterTypeString),
+			Overwrite: aws.Bool(false),
+		})
+		if err == nil {
+			break
+		}
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ssm.ErrCodeParameterAlreadyExists {
+			log.Errorw("SSM PutParameter Error", "Error", err)
+			return nil, err
+		}
+
+		getParameterResponse, err := ssmSvc.GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+		switch {
+		case isParameterNotFound(err):
+			continue
+		case err != nil:
+			log.Errorw("SSM GetParameter Error", "Error", err)
+			return nil, err
+		}
+
+		if taken, _ := time.Parse(time.RFC3339, aws.StringValue(getParameterResponse.Parameter.Value)); time.Since(taken) > clientLockTimeout {
+			log.Warnw("breaking stale app client lock", "ClientId", clientId, "Taken", taken)
+			ssmSvc.DeleteParametersWithContext(ctx, &ssm.DeleteParametersInput{Names: []*string{aws.String(name)}})
+			continue
+		}
+
+		log.Infow("waiting for app client lock", "ClientId", clientId)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(clientLockRetry):
+		}
+	}
+
+	return func() {
+		_, err := ssmSvc.DeleteParametersWithContext(ctx, &ssm.DeleteParametersInput{Names: []*string{aws.String(name)}})
+		if err != nil {
+			log.Errorw("unable to release app client lock", "ClientId", clientId, "Error", err)
+		}
+	}, nil
+}
+
+// setSupportedProvider enables or disables provider on the app client,
+// leaving every other client setting as it is.
+func setSupportedProvider(ctx context.Context, log *zap.SugaredLogger, svc cognitoidentityprovideriface.CognitoIdentityProviderAPI, ssmSvc ssmiface.SSMAPI, userPoolId, clientId, provider string, enabled bool) error {
+	unlock, err := lockClient(ctx, log, ssmSvc, clientId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	client, err := describeClient(ctx, log, svc, userPoolId, clientId)
+	if err != nil {
+		return err
+	}
+
+	providers := []*string{}
+	for _, p := range client.SupportedIdentityProviders {
+		if *p != provider {
+			providers = append(providers, p)
+		}
+	}
+	if enabled {
+		providers = append(providers, aws.String(provider))
+	}
+
+	// UpdateUserPoolClient resets anything that isn't passed in, so copy the
+	// current configuration over
+	updateClientRequest := &cognito.UpdateUserPoolClientInput{
+		UserPoolId:                      client.UserPoolId,
+		ClientId:                        client.ClientId,
+		ClientName:                      client.ClientName,
+		RefreshTokenValidity:            client.RefreshTokenValidity,
+		AccessTokenValidity:             client.AccessTokenValidity,
+		IdTokenValidity:                 client.IdTokenValidity,
+		TokenValidityUnits:              client.TokenValidityUnits,
+		PreventUserExistenceErrors:      client.PreventUserExistenceErrors,
+		ReadAttributes:                  client.ReadAttributes,
+		WriteAttributes:                 client.WriteAttributes,
+		ExplicitAuthFlows:               client.ExplicitAuthFlows,
+		SupportedIdentityProviders:      providers,
+		CallbackURLs:                    client.CallbackURLs,
+		LogoutURLs:                      client.LogoutURLs,
+		DefaultRedirectURI:              client.DefaultRedirectURI,
+		AllowedOAuthFlows:               client.AllowedOAuthFlows,
+		AllowedOAuthScopes:              client.AllowedOAuthScopes,
+		AllowedOAuthFlowsUserPoolClient: client.AllowedOAuthFlowsUserPoolClient,
+		AnalyticsConfiguration:          client.AnalyticsConfiguration,
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Request", "Request", structs.Map(updateClientRequest))
+
+	updateClientResponse, err := svc.UpdateUserPoolClientWithContext(ctx, updateClientRequest)
+	if err != nil {
+		log.Errorw("Cognito UpdateUserPoolClient Error", "Error", err)
+		return err
+	}
+
+	// The client may be confidential, don't log its secret
+	log.Infow("Cognito UpdateUserPoolClient Response", "ClientName", updateClientResponse.UserPoolClient.ClientName, "ClientId", updateClientResponse.UserPoolClient.ClientId)
+
+	return nil
+}
+
+func describeClient(ctx context.Context, log *zap.SugaredLogger, svc cognitoidentityprovideriface.CognitoIdentityProviderAPI, userPoolId, clientId string) (*cognito.UserPoolClientType, error) {
+	describeClientRequest := &cognito.DescribeUserPoolClientInput{
+		UserPoolId: aws.String(userPoolId),
+		ClientId:   aws.String(clientId),
+	}
+
+	log.Infow("Cognito DescribeUserPoolClient Request", "Request", structs.Map(describeClientRequest))
+
+	describeClientResponse, err := svc.DescribeUserPoolClientWithContext(ctx, describeClientRequest)
+	if err != nil {
+		log.Errorw("Cognito DescribeUserPoolClient Error", "Error", err)
+		return nil, err
+	}
+
+	// The client may be confidential, don't log its secret
+	log.Infow("Cognito DescribeUserPoolClient Response", "ClientName", describeClientResponse.UserPoolClient.ClientName, "ClientId", describeClientResponse.UserPoolClient.ClientId)
+
+	return describeClientResponse.UserPoolClient, nil
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// domainProperties are the properties of a Custom::CognitoDomain resource.
+type domainProperties struct {
+	CertificateArn   string `json:"CertificateArn"`
+	AuthDomain       string `json:"AuthDomain"`
+	BaseDomain       string `json:"BaseDomain"`
+	HostedZoneId     string `json:"HostedZoneId"`
+	UserPoolId       string `json:"UserPoolId"`
+	UserPoolClientId string `json:"UserPoolClientId"`
+	CallbackUrl      string `json:"CallbackUrl"`
+	LogoutUrl        string `json:"LogoutUrl"`
+}
+
+// webClientAuthFlows are the sign in flows our own API uses with the web
+// client besides the hosted UI: passwords and the magic link custom auth.
+var webClientAuthFlows = []string{
+	cognito.ExplicitAuthFlowsTypeAllowUserPasswordAuth,
+	cognito.ExplicitAuthFlowsTypeAllowCustomAuth,
+	cognito.ExplicitAuthFlowsTypeAllowRefreshTokenAuth,
+}
+
+// webClientScopes are granted to hosted UI sign ins. The admin scope lets
+// the access token manage its own user, for profile, password and MFA changes.
+var webClientScopes = []string{
+	"https://api.awsci.io/user",
+	"https://api.awsci.io/admin",
+	"aws.cognito.signin.user.admin",
+	"email",
+	"openid",
+	"profile",
+}
+
+// domainHandler sets up the hosted UI custom domain of the user pool, its
+// resource server and the OAuth settings of the app client.
+type domainHandler struct {
+	cognito cognitoidentityprovideriface.CognitoIdentityProviderAPI
+	route53 route53iface.Route53API
+}
+
+func (h *domainHandler) Create(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &domainProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	if request.State["ChangeId"] == "" {
+		changeId := ""
+		changeId, err = h.createResources(ctx, log, props)
+		if err != nil {
+			return
+		}
+		request.State = map[string]string{"ChangeId": changeId}
+	}
+
+	// The resources exist from here on, so a failure while waiting for them
+	// must still let Delete clean up
+	physicalResourceID = props.UserPoolClientId
+
+	if request.State["ChangeSynced"] == "" {
+		var synced bool
+		synced, err = h.waitForChange(ctx, request, request.State["ChangeId"])
+		if err != nil || !synced {
+			err = continueOnTimeout(err, request.State)
+			return
+		}
+		request.State["ChangeSynced"] = "true"
+	}
+
+	var active bool
+	active, err = h.waitForDomain(ctx, request, props.AuthDomain)
+	if err != nil || !active {
+		err = continueOnTimeout(err, request.State)
+		return
+	}
+
+	data = map[string]interface{}{
+		"message": "custom resource created",
+	}
+
+	return
+}
+
+// createResources sets up the user pool domain, resource server, app client and
+// alias record, returning the id of the Route53 change to wait for.
+func (h *domainHandler) createResources(ctx context.Context, log *zap.SugaredLogger, props *domainProperties) (changeId string, err error) {
+	// Undo whatever was set up if a later step fails, so the next attempt
+	// doesn't trip over the leftovers
+	rollback := cfnresource.NewRollback(log)
+	defer func() {
+		if err != nil {
+			err = rollback.Run(err)
+		}
+	}()
+
+	createUserPoolDomainResponse := &cognito.CreateUserPoolDomainOutput{}
+	createUserPoolDomainRequest := &cognito.CreateUserPoolDomainInput{
+		CustomDomainConfig: &cognito.CustomDomainConfigType{
+			CertificateArn: &props.CertificateArn,
+		},
+		Domain:     &props.AuthDomain,
+		UserPoolId: &props.UserPoolId,
+	}
+
+	log.Infow("Cognito CreateUserPoolDomain Request", "Request", structs.Map(createUserPoolDomainRequest))
+
+	createUserPoolDomainResponse, err = h.cognito.CreateUserPoolDomain(createUserPoolDomainRequest)
+
+	if err != nil {
+		log.Errorw("Cognito CreateUserPoolDomain Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito CreateUserPoolDomain Response", "Response", structs.Map(createUserPoolDomainResponse))
+
+	rollback.Add("CreateUserPoolDomain", func() error {
+		return h.deleteDomain(log, props)
+	})
+
+	createResourceServerResponse := &cognito.CreateResourceServerOutput{}
+	createResourceServerRequest := &cognito.CreateResourceServerInput{
+		Identifier: aws.String("https://api.awsci.io"),
+		Name:       aws.String("AWSCI Resource Server"),
+		Scopes: []*cognito.ResourceServerScopeType{
+			{
+				ScopeDescription: aws.String("User Scope"),
+				ScopeName:        aws.String("user"),
+			},
+			{
+				ScopeDescription: aws.String("Admin Scope"),
+				ScopeName:        aws.String("admin"),
+			},
+		},
+		UserPoolId: &props.UserPoolId,
+	}
+
+	log.Infow("Cognito CreateResourceServer Request", "Request", structs.Map(createResourceServerRequest))
+
+	createResourceServerResponse, err = h.cognito.CreateResourceServer(createResourceServerRequest)
+
+	if err != nil {
+		log.Errorw("Cognito CreateResourceServer Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito CreateResourceServer Response", "Response", structs.Map(createResourceServerResponse))
+
+	rollback.Add("CreateResourceServer", func() error {
+		return h.deleteResourceServer(log, props)
+	})
+
+	// Providers may have been enabled on the client before the domain was
+	// set up, they have to survive the update
+	providers, err := supportedProviders(ctx, log, h.cognito, props.UserPoolId, props.UserPoolClientId)
+	if err != nil {
+		return
+	}
+
+	updateClientResponse := &cognito.UpdateUserPoolClientOutput{}
+	updateClientRequest := &cognito.UpdateUserPoolClientInput{
+		UserPoolId:                      aws.String(props.UserPoolId),
+		ClientId:                        aws.String(props.UserPoolClientId),
+		RefreshTokenValidity:            aws.Int64(30),
+		ExplicitAuthFlows:               aws.StringSlice(webClientAuthFlows),
+		SupportedIdentityProviders:      providers,
+		CallbackURLs:                    []*string{aws.String(props.CallbackUrl)},
+		LogoutURLs:                      []*string{aws.String(props.LogoutUrl)},
+		AllowedOAuthFlows:               []*string{aws.String(cognito.OAuthFlowTypeCode)},
+		AllowedOAuthScopes:              aws.StringSlice(webClientScopes),
+		AllowedOAuthFlowsUserPoolClient: aws.Bool(true),
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Request", "Request", structs.Map(updateClientRequest))
+
+	updateClientResponse, err = h.cognito.UpdateUserPoolClient(updateClientRequest)
+
+	if err != nil {
+		log.Errorw("Cognito UpdateUserPoolClient Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Response", "Response", structs.Map(updateClientResponse))
+
+	rollback.Add("UpdateUserPoolClient", func() error {
+		return h.resetClient(log, props)
+	})
+
+	zoneId := ""
+	zoneId, err = h.findHostedZone(log, props)
+	if err != nil {
+		log.Errorw("Route53 Zone Lookup Error", "Error", err)
+		return
+	}
+
+	changeResourceRecordResponse := &route53.ChangeResourceRecordSetsOutput{}
+	changeResourceRecordRequest := &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: aliasChanges(route53.ChangeActionCreate, props.AuthDomain, *createUserPoolDomainResponse.CloudFrontDomain),
+			Comment: aws.String("api domain for cognito"),
+		},
+		HostedZoneId: &zoneId,
+	}
+
+	log.Infow("Route53 ChangeResourceRecordSets Request", "Request", structs.Map(changeResourceRecordRequest))
+
+	changeResourceRecordResponse, err = h.route53.ChangeResourceRecordSets(changeResourceRecordRequest)
+	if err != nil {
+		log.Errorw("Route53 ChangeResourceRecordSets Error", "Error", err)
+		return
+	}
+
+	log.Infow("Route53 ChangeResourceRecordSets Response", "Response", structs.Map(changeResourceRecordResponse))
+
+	changeId = *changeResourceRecordResponse.ChangeInfo.Id
+
+	return
+}
+
+// waitForChange polls Route53 until changeId has propagated to all of its
+// authoritative name servers.
+func (h *domainHandler) waitForChange(ctx context.Context, request *cfnresource.Request, changeId string) (bool, error) {
+	return request.Poll(ctx, 10*time.Second, func() (bool, error) {
+		getChangeResponse, err := h.route53.GetChangeWithContext(ctx, &route53.GetChangeInput{
+			Id: aws.String(changeId),
+		})
+		if err != nil {
+			request.Log.Errorw("Route53 GetChange Error", "Error", err)
+			return false, err
+		}
+
+		request.Log.Infow("Route53 GetChange Response", "Response", structs.Map(getChangeResponse))
+
+		return *getChangeResponse.ChangeInfo.Status == route53.ChangeStatusInsync, nil
+	})
+}
+
+// waitForDomain polls Cognito until the CloudFront distribution behind the
+// custom domain has been deployed.
+func (h *domainHandler) waitForDomain(ctx context.Context, request *cfnresource.Request, domain string) (bool, error) {
+	return request.Poll(ctx, 30*time.Second, func() (bool, error) {
+		describeUserPoolDomainResponse, err := h.cognito.DescribeUserPoolDomainWithContext(ctx, &cognito.DescribeUserPoolDomainInput{
+			Domain: aws.String(domain),
+		})
+		if err != nil {
+			request.Log.Errorw("Cognito DescribeUserPoolDomain Error", "Error", err)
+			return false, err
+		}
+
+		request.Log.Infow("Cognito DescribeUserPoolDomain Response", "Response", structs.Map(describeUserPoolDomainResponse))
+
+		description := describeUserPoolDomainResponse.DomainDescription
+		if description == nil || description.Status == nil {
+			return false, fmt.Errorf("user pool domain %s not found", domain)
+		}
+
+		switch *description.Status {
+		case cognito.DomainStatusTypeActive:
+			return true, nil
+		case cognito.DomainStatusTypeFailed:
+			return false, fmt.Errorf("user pool domain %s failed to deploy", domain)
+		}
+
+		return false, nil
+	})
+}
+
+// continueOnTimeout hands a pending wait over to the next invocation unless
+// it failed outright.
+func continueOnTimeout(err error, state map[string]string) error {
+	if err != nil {
+		return err
+	}
+	return cfnresource.Continue(state)
+}
+
+func (h *domainHandler) Update(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &domainProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	physicalResourceID = props.UserPoolClientId
+
+	providers := []*string{}
+	providers, err = supportedProviders(ctx, log, h.cognito, props.UserPoolId, props.UserPoolClientId)
+	if err != nil {
+		return
+	}
+
+	updateClientResponse := &cognito.UpdateUserPoolClientOutput{}
+	updateClientRequest := &cognito.UpdateUserPoolClientInput{
+		UserPoolId:                      aws.String(props.UserPoolId),
+		ClientId:                        aws.String(props.UserPoolClientId),
+		RefreshTokenValidity:            aws.Int64(30),
+		ExplicitAuthFlows:               aws.StringSlice(webClientAuthFlows),
+		SupportedIdentityProviders:      providers,
+		CallbackURLs:                    []*string{aws.String(props.CallbackUrl)},
+		LogoutURLs:                      []*string{aws.String(props.LogoutUrl)},
+		AllowedOAuthFlows:               []*string{aws.String(cognito.OAuthFlowTypeCode)},
+		AllowedOAuthScopes:              aws.StringSlice(webClientScopes),
+		AllowedOAuthFlowsUserPoolClient: aws.Bool(true),
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Request", "Request", structs.Map(updateClientRequest))
+
+	updateClientResponse, err = h.cognito.UpdateUserPoolClient(updateClientRequest)
+
+	if err != nil {
+		log.Errorw("Cognito UpdateUserPoolClient Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Response", "Response", structs.Map(updateClientResponse))
+
+	data = map[string]interface{}{
+		"message": "custom resource updated",
+	}
+
+	return
+}
+
+func (h *domainHandler) Delete(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &domainProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	physicalResourceID = request.PhysicalResourceID
+
+	// A Create that failed before the resources were set up reports the log stream
+	// name as its physical resource id, so there is nothing of ours to clean up.
+	if request.PhysicalResourceID != props.UserPoolClientId {
+		log.Infow("resource was not created by this function, skipping delete", "PhysicalResourceID", request.PhysicalResourceID)
+		data = map[string]interface{}{
+			"message": "custom resource not found",
+		}
+		return
+	}
+
+	var errs error
+
+	// Without a zone there are no records to delete, but if the lookup itself
+	// failed they may still point at the domain, which has to stay until a
+	// retry can remove them
+	zoneId, zoneErr := h.findHostedZone(log, props)
+	switch {
+	case zoneErr == errNoHostedZone:
+		log.Warnw("Route53 HostedZone not found, skipping record deletion", "Domain", props.AuthDomain)
+	case zoneErr != nil:
+		log.Errorw("Route53 Zone Lookup Error", "Error", zoneErr)
+		errs = multierr.Append(errs, zoneErr)
+	}
+
+	cloudFrontDomain := ""
+	describeUserPoolDomainResponse := &cognito.DescribeUserPoolDomainOutput{}
+	describeUserPoolDomainRequest := &cognito.DescribeUserPoolDomainInput{
+		Domain: aws.String(props.AuthDomain),
+	}
+
+	log.Infow("Cognito DescribeUserPoolDomain Request", "Request", structs.Map(describeUserPoolDomainRequest))
+
+	describeUserPoolDomainResponse, err = h.cognito.DescribeUserPoolDomain(describeUserPoolDomainRequest)
+	switch {
+	case err != nil && !isNotFound(err):
+		log.Errorw("Cognito DescribeUserPoolDomain Error", "Error", err)
+		errs = multierr.Append(errs, err)
+	case err != nil:
+		log.Warnw("Cognito user pool domain already deleted", "Domain", props.AuthDomain)
+	default:
+		log.Infow("Cognito DescribeUserPoolDomain Response", "Response", structs.Map(describeUserPoolDomainResponse))
+		// Cognito answers with an empty description rather than an error for unknown domains
+		if d := describeUserPoolDomainResponse.DomainDescription; d != nil && d.CloudFrontDistribution != nil {
+			cloudFrontDomain = *d.CloudFrontDistribution
+		} else {
+			log.Warnw("Cognito user pool domain already deleted", "Domain", props.AuthDomain)
+		}
+	}
+
+	if zoneId != "" && cloudFrontDomain != "" {
+		// Delete the records one at a time, stacks created before AAAA records
+		// were added only have the A record
+		for _, change := range aliasChanges(route53.ChangeActionDelete, props.AuthDomain, cloudFrontDomain) {
+			changeResourceRecordResponse := &route53.ChangeResourceRecordSetsOutput{}
+			changeResourceRecordRequest := &route53.ChangeResourceRecordSetsInput{
+				ChangeBatch: &route53.ChangeBatch{
+					Changes: []*route53.Change{change},
+					Comment: aws.String("api domain for Cognito"),
+				},
+				HostedZoneId: &zoneId,
+			}
+
+			log.Infow("Route53 ChangeResourceRecordSets Request", "Request", structs.Map(changeResourceRecordRequest))
+
+			changeResourceRecordResponse, err = h.route53.ChangeResourceRecordSets(changeResourceRecordRequest)
+			switch {
+			case err != nil && !isNotFound(err):
+				log.Errorw("Route53 ChangeResourceRecordSets Error", "Error", err)
+				errs = multierr.Append(errs, err)
+			case err != nil:
+				log.Warnw("Route53 record already deleted", "Name", props.AuthDomain, "Type", *change.ResourceRecordSet.Type)
+			default:
+				log.Infow("Route53 ChangeResourceRecordSets Response", "Response", structs.Map(changeResourceRecordResponse))
+			}
+		}
+	}
+
+	err = h.resetClient(log, props)
+	switch {
+	case err != nil && !isNotFound(err):
+		log.Errorw("Cognito UpdateUserPoolClient Error", "Error", err)
+		errs = multierr.Append(errs, err)
+	case err != nil:
+		log.Warnw("Cognito user pool client already deleted", "ClientId", props.UserPoolClientId)
+	}
+
+	err = h.deleteResourceServer(log, props)
+	switch {
+	case err != nil && !isNotFound(err):
+		log.Errorw("Cognito DeleteResourceServer Error", "Error", err)
+		errs = multierr.Append(errs, err)
+	case err != nil:
+		log.Warnw("Cognito resource server already deleted", "Identifier", "https://api.awsci.io")
+	}
+
+	if cloudFrontDomain != "" && (zoneErr == nil || zoneErr == errNoHostedZone) {
+		err = h.deleteDomain(log, props)
+		switch {
+		case err != nil && !isNotFound(err):
+			log.Errorw("Cognito DeleteUserPoolDomain Error", "Error", err)
+			errs = multierr.Append(errs, err)
+		case err != nil:
+			log.Warnw("Cognito user pool domain already deleted", "Domain", props.AuthDomain)
+		}
+	}
+
+	// Only the aggregated failures count, err may still hold a tolerated one
+	err = errs
+	if err != nil {
+		return
+	}
+
+	data = map[string]interface{}{
+		"message": "custom resource deleted",
+	}
+
+	return
+}
+
+// resetClient turns the hosted UI settings of the app client off again.
+func (h *domainHandler) resetClient(log *zap.SugaredLogger, props *domainProperties) error {
+	updateClientRequest := &cognito.UpdateUserPoolClientInput{
+		UserPoolId:                      aws.String(props.UserPoolId),
+		ClientId:                        aws.String(props.UserPoolClientId),
+		RefreshTokenValidity:            aws.Int64(30),
+		ExplicitAuthFlows:               []*string{},
+		SupportedIdentityProviders:      []*string{},
+		CallbackURLs:                    []*string{},
+		LogoutURLs:                      []*string{},
+		AllowedOAuthFlows:               []*string{},
+		AllowedOAuthScopes:              []*string{},
+		AllowedOAuthFlowsUserPoolClient: aws.Bool(false),
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Request", "Request", structs.Map(updateClientRequest))
+
+	updateClientResponse, err := h.cognito.UpdateUserPoolClient(updateClientRequest)
+	if err != nil {
+		return err
+	}
+
+	log.Infow("Cognito UpdateUserPoolClient Response", "Response", structs.Map(updateClientResponse))
+
+	return nil
+}
+
+func (h *domainHandler) deleteResourceServer(log *zap.SugaredLogger, props *domainProperties) error {
+	deleteResourceServerRequest := &cognito.DeleteResourceServerInput{
+		Identifier: aws.String("https://api.awsci.io"),
+		UserPoolId: &props.UserPoolId,
+	}
+
+	log.Infow("Cognito DeleteResourceServer Request", "Request", structs.Map(deleteResourceServerRequest))
+
+	deleteResourceServerResponse, err := h.cognito.DeleteResourceServer(deleteResourceServerRequest)
+	if err != nil {
+		return err
+	}
+
+	log.Infow("Cognito DeleteResourceServer Response", "Response", structs.Map(deleteResourceServerResponse))
+
+	return nil
+}
+
+func (h *domainHandler) deleteDomain(log *zap.SugaredLogger, props *domainProperties) error {
+	deleteUserPoolDomainRequest := &cognito.DeleteUserPoolDomainInput{
+		Domain:     &props.AuthDomain,
+		UserPoolId: &props.UserPoolId,
+	}
+
+	log.Infow("Cognito DeleteUserPoolDomain Request", "Request", structs.Map(deleteUserPoolDomainRequest))
+
+	deleteUserPoolDomainResponse, err := h.cognito.DeleteUserPoolDomain(deleteUserPoolDomainRequest)
+	if err != nil {
+		return err
+	}
+
+	log.Infow("Cognito DeleteUserPoolDomain Response", "Response", structs.Map(deleteUserPoolDomainResponse))
+
+	return nil
+}
+
+// errNoHostedZone is returned by findHostedZone when no public zone contains
+// the auth domain.
+var errNoHostedZone = errors.New("unable to find a public HostedZone for the auth domain")
+
+// findHostedZone returns the HostedZoneId property if set, otherwise the most
+// specific public hosted zone containing the auth domain. BaseDomain, when
+// given, restricts the lookup to zones of that name.
+func (h *domainHandler) findHostedZone(log *zap.SugaredLogger, props *domainProperties) (string, error) {
+	if props.HostedZoneId != "" {
+		return props.HostedZoneId, nil
+	}
+
+	authDomain := strings.ToLower(strings.TrimSuffix(props.AuthDomain, ".")) + "."
+	baseDomain := strings.ToLower(strings.TrimSuffix(props.BaseDomain, "."))
+
+	zoneId, zoneName := "", ""
+	listHostedZonesRequest := &route53.ListHostedZonesInput{}
+
+	log.Infow("Route53 ListHostedZones Request", "Request", structs.Map(listHostedZonesRequest))
+
+	err := h.route53.ListHostedZonesPages(listHostedZonesRequest, func(page *route53.ListHostedZonesOutput, lastPage bool) bool {
+		for _, zone := range page.HostedZones {
+			name := strings.ToLower(*zone.Name)
+			if zone.Config != nil && aws.BoolValue(zone.Config.PrivateZone) {
+				continue
+			}
+			if baseDomain != "" && name != baseDomain+"." {
+				continue
+			}
+			if authDomain != name && !strings.HasSuffix(authDomain, "."+name) {
+				continue
+			}
+			if len(name) > len(zoneName) {
+				zoneId, zoneName = *zone.Id, name
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.Errorw("Route53 ListHostedZones Error", "Error", err)
+		return "", err
+	}
+
+	if zoneId == "" {
+		log.Errorw("Route53 HostedZone not found", "Domain", props.AuthDomain)
+		return "", errNoHostedZone
+	}
+
+	log.Infow("Route53 HostedZone found", "HostedZoneId", zoneId, "Name", zoneName)
+
+	return zoneId, nil
+}
+
+// aliasChanges returns the A and AAAA alias records pointing name at the
+// CloudFront distribution of the user pool domain.
+func aliasChanges(action, name, cloudFrontDomain string) []*route53.Change {
+	changes := []*route53.Change{}
+	for _, recordType := range []string{route53.RRTypeA, route53.RRTypeAaaa} {
+		changes = append(changes, &route53.Change{
+			Action: aws.String(action),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name: aws.String(name),
+				AliasTarget: &route53.AliasTarget{
+					DNSName:              aws.String(cloudFrontDomain),
+					EvaluateTargetHealth: aws.Bool(false),
+					// CloudFront Hosted Zone ID: https://docs.aws.amazon.com/general/latest/gr/rande.html#cf_region
+					HostedZoneId: aws.String("Z2FDTNDATAQYW2"),
+				},
+				Type: aws.String(recordType),
+			},
+		})
+	}
+	return changes
+}
+
+// isNotFound reports whether err means the resource being cleaned up is already gone.
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case cognito.ErrCodeResourceNotFoundException, route53.ErrCodeNoSuchHostedZone:
+		return true
+	case route53.ErrCodeInvalidChangeBatch, cognito.ErrCodeInvalidParameterException:
+		// Deleting a missing record set or domain is reported as an invalid request
+		return strings.Contains(aerr.Message(), "not found") || strings.Contains(aerr.Message(), "does not exist")
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"go.smartmachine.io/awsci-api/pkg/cfnresource/cfntest"
+	"path/filepath"
+	"testing"
+)
+
+// TestFixtures runs every recorded event in testdata through the router
+// against the fakes.
+func TestFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found in testdata")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			fixture, err := cfntest.LoadFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := cfntest.New()
+			defer h.Close()
+
+			response, err := h.Run(newRouter(h.Cognito, h.Route53, h.SSM, h.Lambda), fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = h.Check(fixture, response); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	"go.uber.org/multierr"
+	"strings"
+)
+
+// providerTypeGitHub is a GitHub OAuth app fronted by an OIDC shim, since
+// GitHub doesn't implement OpenID Connect itself.
+const providerTypeGitHub = "GitHub"
+
+// providerProperties are the properties of a Custom::CognitoIdentityProvider
+// resource. ProviderType is one of OIDC, Google, SAML or GitHub.
+type providerProperties struct {
+	UserPoolId       string            `json:"UserPoolId"`
+	UserPoolClientId string            `json:"UserPoolClientId"`
+	ProviderName     string            `json:"ProviderName"`
+	ProviderType     string            `json:"ProviderType"`
+	ClientId         string            `json:"ClientId"`
+	ClientSecret     string            `json:"ClientSecret"`
+	AuthorizeScopes  string            `json:"AuthorizeScopes"`
+	Issuer           string            `json:"Issuer"`
+	ShimUrl          string            `json:"ShimUrl"`
+	MetadataUrl      string            `json:"MetadataUrl"`
+	AttributeMapping map[string]string `json:"AttributeMapping"`
+	IdpIdentifiers   []string          `json:"IdpIdentifiers"`
+}
+
+// providerHandler manages a federated identity provider of the user pool and
+// enables it on the app client's hosted UI.
+type providerHandler struct {
+	cognito cognitoidentityprovideriface.CognitoIdentityProviderAPI
+	ssm     ssmiface.SSMAPI
+}
+
+// cognitoType returns the Cognito provider type and details for the properties.
+func (p *providerProperties) cognitoType() (string, map[string]*string, error) {
+	switch p.ProviderType {
+	case cognito.IdentityProviderTypeTypeOidc:
+		if p.Issuer == "" {
+			return "", nil, fmt.Errorf("Issuer is required for OIDC provider %s", p.ProviderName)
+		}
+		return cognito.IdentityProviderTypeTypeOidc, aws.StringMap(map[string]string{
+			"client_id":                 p.ClientId,
+			"client_secret":             p.ClientSecret,
+			"authorize_scopes":          p.scopes("openid email profile"),
+			"oidc_issuer":               p.Issuer,
+			"attributes_request_method": "GET",
+		}), nil
+
+	case providerTypeGitHub:
+		if p.ShimUrl == "" {
+			return "", nil, fmt.Errorf("ShimUrl is required for GitHub provider %s", p.ProviderName)
+		}
+		shim := strings.TrimSuffix(p.ShimUrl, "/")
+		return cognito.IdentityProviderTypeTypeOidc, aws.StringMap(map[string]string{
+			"client_id":                 p.ClientId,
+			"client_secret":             p.ClientSecret,
+			"authorize_scopes":          p.scopes("openid read:user user:email"),
+			"oidc_issuer":               shim,
+			"authorize_url":             shim + "/authorize",
+			"token_url":                 shim + "/token",
+			"attributes_url":            shim + "/userinfo",
+			"jwks_uri":                  shim + "/.well-known/jwks.json",
+			"attributes_request_method": "GET",
+		}), nil
+
+	case cognito.IdentityProviderTypeTypeGoogle:
+		return cognito.IdentityProviderTypeTypeGoogle, aws.StringMap(map[string]string{
+			"client_id":        p.ClientId,
+			"client_secret":    p.ClientSecret,
+			"authorize_scopes": p.scopes("openid email profile"),
+		}), nil
+
+	case cognito.IdentityProviderTypeTypeSaml:
+		if p.MetadataUrl == "" {
+			return "", nil, fmt.Errorf("MetadataUrl is required for SAML provider %s", p.ProviderName)
+		}
+		return cognito.IdentityProviderTypeTypeSaml, aws.StringMap(map[string]string{
+			"MetadataURL": p.MetadataUrl,
+		}), nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported ProviderType %s", p.ProviderType)
+}
+
+func (p *providerProperties) scopes(defaultScopes string) string {
+	if p.AuthorizeScopes != "" {
+		return p.AuthorizeScopes
+	}
+	return defaultScopes
+}
+
+func (h *providerHandler) Create(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &providerProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	providerType, details, err := props.cognitoType()
+	if err != nil {
+		return
+	}
+
+	createProviderRequest := &cognito.CreateIdentityProviderInput{
+		UserPoolId:       aws.String(props.UserPoolId),
+		ProviderName:     aws.String(props.ProviderName),
+		ProviderType:     aws.String(providerType),
+		ProviderDetails:  details,
+		AttributeMapping: aws.StringMap(props.AttributeMapping),
+		IdpIdentifiers:   aws.StringSlice(props.IdpIdentifiers),
+	}
+
+	log.Infow("Cognito CreateIdentityProvider Request", "ProviderName", props.ProviderName, "ProviderType", providerType)
+
+	createProviderResponse, err := h.cognito.CreateIdentityProviderWithContext(ctx, createProviderRequest)
+	if err != nil {
+		log.Errorw("Cognito CreateIdentityProvider Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito CreateIdentityProvider Response", "ProviderName", createProviderResponse.IdentityProvider.ProviderName)
+
+	physicalResourceID = props.ProviderName
+
+	if props.UserPoolClientId != "" {
+		err = setSupportedProvider(ctx, log, h.cognito, h.ssm, props.UserPoolId, props.UserPoolClientId, props.ProviderName, true)
+		if err != nil {
+			return
+		}
+	}
+
+	data = map[string]interface{}{
+		"ProviderName": props.ProviderName,
+	}
+
+	return
+}
+
+func (h *providerHandler) Update(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	props := &providerProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	oldProps := &providerProperties{}
+	if err = request.DecodeOldProperties(oldProps); err != nil {
+		return
+	}
+
+	// Providers can't be renamed or moved, create a replacement and let
+	// CloudFormation delete the old one
+	if props.ProviderName != oldProps.ProviderName || props.UserPoolId != oldProps.UserPoolId {
+		return h.Create(ctx, request)
+	}
+
+	physicalResourceID = request.PhysicalResourceID
+
+	_, details, err := props.cognitoType()
+	if err != nil {
+		return
+	}
+
+	updateProviderRequest := &cognito.UpdateIdentityProviderInput{
+		UserPoolId:       aws.String(props.UserPoolId),
+		ProviderName:     aws.String(props.ProviderName),
+		ProviderDetails:  details,
+		AttributeMapping: aws.StringMap(props.AttributeMapping),
+		IdpIdentifiers:   aws.StringSlice(props.IdpIdentifiers),
+	}
+
+	log.Infow("Cognito UpdateIdentityProvider Request", "ProviderName", props.ProviderName)
+
+	updateProviderResponse, err := h.cognito.UpdateIdentityProviderWithContext(ctx, updateProviderRequest)
+	if err != nil {
+		log.Errorw("Cognito UpdateIdentityProvider Error", "Error", err)
+		return
+	}
+
+	log.Infow("Cognito UpdateIdentityProvider Response", "ProviderName", updateProviderResponse.IdentityProvider.ProviderName)
+
+	if oldProps.UserPoolClientId != "" && oldProps.UserPoolClientId != props.UserPoolClientId {
+		err = setSupportedProvider(ctx, log, h.cognito, h.ssm, oldProps.UserPoolId, oldProps.UserPoolClientId, props.ProviderName, false)
+		if err != nil && !isNotFound(err) {
+			return
+		}
+	}
+
+	if props.UserPoolClientId != "" {
+		err = setSupportedProvider(ctx, log, h.cognito, h.ssm, props.UserPoolId, props.UserPoolClientId, props.ProviderName, true)
+		if err != nil {
+			return
+		}
+	}
+
+	data = map[string]interface{}{
+		"ProviderName": props.ProviderName,
+	}
+
+	return
+}
+
+func (h *providerHandler) Delete(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	log := request.Log
+
+	physicalResourceID = request.PhysicalResourceID
+
+	props := &providerProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	if request.PhysicalResourceID != props.ProviderName {
+		log.Infow("resource was not created by this function, skipping delete", "PhysicalResourceID", request.PhysicalResourceID)
+		return
+	}
+
+	var errs error
+
+	// The provider can't be deleted while a client still refers to it
+	if props.UserPoolClientId != "" {
+		err = setSupportedProvider(ctx, log, h.cognito, h.ssm, props.UserPoolId, props.UserPoolClientId, props.ProviderName, false)
+		if err != nil && !isNotFound(err) {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	deleteProviderRequest := &cognito.DeleteIdentityProviderInput{
+		UserPoolId:   aws.String(props.UserPoolId),
+		ProviderName: aws.String(props.ProviderName),
+	}
+
+	log.Infow("Cognito DeleteIdentityProvider Request", "Request", structs.Map(deleteProviderRequest))
+
+	deleteProviderResponse, err := h.cognito.DeleteIdentityProviderWithContext(ctx, deleteProviderRequest)
+	switch {
+	case err != nil && !isNotFound(err):
+		log.Errorw("Cognito DeleteIdentityProvider Error", "Error", err)
+		errs = multierr.Append(errs, err)
+	case err != nil:
+		log.Warnw("Cognito identity provider already deleted", "ProviderName", props.ProviderName)
+	default:
+		log.Infow("Cognito DeleteIdentityProvider Response", "Response", structs.Map(deleteProviderResponse))
+	}
+
+	err = errs
+
+	return
+}
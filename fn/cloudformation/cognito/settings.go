@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	params "go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.uber.org/multierr"
+	"sort"
+	"strings"
+)
+
+// settingsProperties are the properties of a Custom::CognitoClientSettings
+// resource. RedirectUris and LogoutUris are the allowlists clients may be
+// sent to after signing in and out, LogoutUrl the sign out URL registered on
+// the app client. Parameters holds additional keys published below /cognito/.
+type settingsProperties struct {
+	ClientId     string            `json:"ClientId"`
+	CallbackUrl  string            `json:"CallbackUrl"`
+	RedirectUris []string          `json:"RedirectUris"`
+	LogoutUris   []string          `json:"LogoutUris"`
+	LogoutUrl    string            `json:"LogoutUrl"`
+	AuthDomain   string            `json:"AuthDomain"`
+	Issuer       string            `json:"Issuer"`
+	Parameters   map[string]string `json:"Parameters"`
+}
+
+// settingsHandler publishes the app client settings the API Lambdas read
+// from SSM Parameter Store.
+type settingsHandler struct {
+	ssm ssmiface.SSMAPI
+}
+
+// settingsPhysicalID is the physical resource id of every settings resource.
+const settingsPhysicalID = "/cognito"
+
+// fixedParameters are published from their own properties, Parameters may
+// not override them.
+var fixedParameters = map[string]bool{
+	params.ClientIDParameter:     true,
+	params.CallbackURLParameter:  true,
+	params.RedirectURIsParameter: true,
+	params.LogoutURIsParameter:   true,
+	params.LogoutURLParameter:    true,
+	params.AuthDomainParameter:   true,
+	params.IssuerParameter:       true,
+}
+
+// validate rejects Parameters keys that collide with the fixed parameters.
+func (p *settingsProperties) validate() error {
+	for key := range p.Parameters {
+		if name := "/cognito/" + strings.TrimPrefix(key, "/"); fixedParameters[name] {
+			return fmt.Errorf("parameter %s is set by its own property", key)
+		}
+	}
+	return nil
+}
+
+// parameters maps the properties to the SSM parameters they are stored in.
+func (p *settingsProperties) parameters() map[string]string {
+	parameters := map[string]string{}
+	for key, value := range p.Parameters {
+		parameters["/cognito/"+strings.TrimPrefix(key, "/")] = value
+	}
+
+	for name, value := range map[string]string{
+		params.ClientIDParameter:     p.ClientId,
+		params.CallbackURLParameter:  p.CallbackUrl,
+		params.RedirectURIsParameter: strings.Join(p.RedirectUris, ","),
+		params.LogoutURIsParameter:   strings.Join(p.LogoutUris, ","),
+		params.LogoutURLParameter:    p.LogoutUrl,
+		params.AuthDomainParameter:   p.AuthDomain,
+		params.IssuerParameter:       p.Issuer,
+	} {
+		if value != "" {
+			parameters[name] = value
+		}
+	}
+
+	return parameters
+}
+
+func (h *settingsHandler) Create(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	props := &settingsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+	if err = props.validate(); err != nil {
+		return
+	}
+
+	rollback := cfnresource.NewRollback(request.Log)
+	if err = h.putParameters(ctx, request, props.parameters(), rollback); err != nil {
+		err = rollback.Run(err)
+		return
+	}
+
+	physicalResourceID = settingsPhysicalID
+	data = map[string]interface{}{
+		"message": "client settings published",
+	}
+
+	return
+}
+
+func (h *settingsHandler) Update(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	props := &settingsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	if err = props.validate(); err != nil {
+		return
+	}
+
+	oldProps := &settingsProperties{}
+	if err = request.DecodeOldProperties(oldProps); err != nil {
+		return
+	}
+
+	physicalResourceID = request.PhysicalResourceID
+
+	parameters := props.parameters()
+	if err = h.putParameters(ctx, request, parameters, nil); err != nil {
+		return
+	}
+
+	removed := []string{}
+	for name := range oldProps.parameters() {
+		if _, ok := parameters[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	if err = h.deleteParameters(ctx, request, removed); err != nil {
+		return
+	}
+
+	data = map[string]interface{}{
+		"message": "client settings updated",
+	}
+
+	return
+}
+
+func (h *settingsHandler) Delete(ctx context.Context, request *cfnresource.Request) (physicalResourceID string, data map[string]interface{}, err error) {
+	physicalResourceID = request.PhysicalResourceID
+
+	props := &settingsProperties{}
+	if err = request.DecodeProperties(props); err != nil {
+		return
+	}
+
+	// A Create that failed reports the log stream name as its physical
+	// resource id, the parameters belong to the live resource then
+	if request.PhysicalResourceID != settingsPhysicalID {
+		request.Log.Infow("resource was not created by this function, skipping delete", "PhysicalResourceID", request.PhysicalResourceID)
+		data = map[string]interface{}{
+			"message": "custom resource not found",
+		}
+		return
+	}
+
+	names, err := h.ownedParameters(ctx, request, props.parameters())
+	if err != nil {
+		return
+	}
+
+	if err = h.deleteParameters(ctx, request, names); err != nil {
+		return
+	}
+
+	data = map[string]interface{}{
+		"message": "client settings deleted",
+	}
+
+	return
+}
+
+// ownedParameters returns the names that still hold the values of this
+// resource. Those that changed were published by a resource replacing it.
+func (h *settingsHandler) ownedParameters(ctx context.Context, request *cfnresource.Request, parameters map[string]string) ([]string, error) {
+	log := request.Log
+
+	names := []string{}
+	for name, value := range parameters {
+		getParameterResponse, err := h.ssm.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name: aws.String(name),
+		})
+		if isParameterNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Errorw("SSM GetParameter Error", "Error", err)
+			return nil, err
+		}
+
+		if aws.StringValue(getParameterResponse.Parameter.Value) != value {
+			log.Warnw("parameter was changed by another resource, keeping it", "Name", name)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// putParameters publishes parameters. With a rollback, the delete of each
+// parameter that didn't exist before is added to it as soon as it is written.
+func (h *settingsHandler) putParameters(ctx context.Context, request *cfnresource.Request, parameters map[string]string, rollback *cfnresource.Rollback) error {
+	log := request.Log
+
+	// In order, so a failure part way through leaves the same parameters
+	// behind every time
+	names := []string{}
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		name := name
+		putParameterRequest := &ssm.PutParameterInput{
+			Name:      aws.String(name),
+			Value:     aws.String(parameters[name]),
+			Type:      aws.String(ssm.ParameterTypeString),
+			Overwrite: aws.Bool(true),
+		}
+
+		log.Infow("SSM PutParameter Request", "Request", structs.Map(putParameterRequest))
+
+		putParameterResponse, err := h.ssm.PutParameterWithContext(ctx, putParameterRequest)
+		if err != nil {
+			log.Errorw("SSM PutParameter Error", "Error", err)
+			return err
+		}
+
+		log.Infow("SSM PutParameter Response", "Response", structs.Map(putParameterResponse))
+
+		// Version 1 is a new parameter, older ones belong to whoever wrote them
+		if rollback != nil && aws.Int64Value(putParameterResponse.Version) == 1 {
+			rollback.Add("PutParameter "+name, func() error {
+				return h.deleteParameters(ctx, request, []string{name})
+			})
+		}
+	}
+
+	return nil
+}
+
+// deleteParameters removes names from the parameter store, treating
+// parameters that are already gone as deleted.
+func (h *settingsHandler) deleteParameters(ctx context.Context, request *cfnresource.Request, names []string) error {
+	log := request.Log
+
+	var errs error
+
+	// DeleteParameters accepts at most 10 names per call
+	for start := 0; start < len(names); start += 10 {
+		end := start + 10
+		if end > len(names) {
+			end = len(names)
+		}
+
+		deleteParametersRequest := &ssm.DeleteParametersInput{
+			Names: aws.StringSlice(names[start:end]),
+		}
+
+		log.Infow("SSM DeleteParameters Request", "Request", structs.Map(deleteParametersRequest))
+
+		deleteParametersResponse, err := h.ssm.DeleteParametersWithContext(ctx, deleteParametersRequest)
+		if err != nil {
+			log.Errorw("SSM DeleteParameters Error", "Error", err)
+			errs = multierr.Append(errs, err)
+			continue
+		}
+
+		log.Infow("SSM DeleteParameters Response", "Response", structs.Map(deleteParametersResponse))
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/satori/go.uuid"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.uber.org/zap"
+)
+
+// AuthorizeRequest starts a hosted UI sign in that ends at RedirectURI,
+// which has to be on the allowlist of the app client named Client, or of
+// the web client without one. State is the client's own nonce, one is made
+// up if it has none.
+type AuthorizeRequest struct {
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+	Client      string `json:"client"`
+}
+
+type AuthorizeResponse struct {
+	AuthorizeURL string `json:"authorize_url"`
+	State        string `json:"state"`
+}
+
+func Authorize(ctx context.Context, request *AuthorizeRequest) (*AuthorizeResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("Authorize()", "RedirectURI", request.RedirectURI, "Client", request.Client)
+
+	redirectURI := request.RedirectURI
+	if redirectURI == "" && request.Client == "" {
+		info, err := ssm.GetClientInfo()
+		if err != nil {
+			return nil, err
+		}
+		if info.CallbackURL != nil {
+			redirectURI = *info.CallbackURL
+		}
+	}
+
+	if err := oauth.CheckRedirectURI(redirectURI, request.Client); err != nil {
+		log.Warnw("redirect uri rejected", "RedirectURI", redirectURI, "Client", request.Client, "Error", err)
+		return nil, err
+	}
+
+	nonce := request.State
+	if nonce == "" {
+		nonce = uuid.NewV4().String()
+	}
+
+	state, err := oauth.NewAuthState(nonce, redirectURI, request.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	cognitoConfig, err := oauth.NewCognitoConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthorizeResponse{
+		AuthorizeURL: cognitoConfig.AuthCodeURL(state),
+		State:        nonce,
+	}, nil
+}
+
+func main() {
+	lambda.Start(Authorize)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+type ChangePasswordRequest struct {
+	oauth.ClientContext
+	AccessToken      *string `json:"access_token"`
+	PreviousPassword string  `json:"previous_password"`
+	ProposedPassword string  `json:"proposed_password"`
+}
+
+type ChangePasswordResponse struct {
+	Status string `json:"status"`
+}
+
+func ChangePassword(ctx context.Context, request ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("ChangePassword()")
+
+	if request.PreviousPassword == "" {
+		return nil, util.NewError("previous_password is required", 400)
+	}
+	if err := util.ValidatePassword(request.ProposedPassword, oauth.GetPasswordPolicy()); err != nil {
+		return nil, err
+	}
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+
+	changePasswordRequest := &cognito.ChangePasswordInput{
+		AccessToken:      aws.String(accessToken),
+		PreviousPassword: aws.String(request.PreviousPassword),
+		ProposedPassword: aws.String(request.ProposedPassword),
+	}
+
+	log.Infow("Cognito ChangePassword Request")
+
+	_, err = oauth.NewCognitoClient().ChangePassword(changePasswordRequest)
+	if oauth.IsCognitoError(err, cognito.ErrCodeNotAuthorizedException) {
+		return nil, util.NewError("the current password is incorrect", 401)
+	}
+	if err != nil {
+		log.Errorw("Cognito ChangePassword Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("password changed")
+
+	return &ChangePasswordResponse{Status: "password_changed"}, nil
+}
+
+func main() {
+	lambda.Start(ChangePassword)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+type ConfirmForgotPasswordRequest struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type ConfirmForgotPasswordResponse struct {
+	Status string `json:"status"`
+}
+
+func ConfirmForgotPassword(ctx context.Context, request *ConfirmForgotPasswordRequest) (*ConfirmForgotPasswordResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	email := util.NormalizeEmail(request.Email)
+
+	log.Infow("ConfirmForgotPassword()", "Email", email)
+
+	if err := util.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+	if err := util.ValidateCode(request.Code); err != nil {
+		return nil, err
+	}
+	if err := util.ValidatePassword(request.Password, oauth.GetPasswordPolicy()); err != nil {
+		return nil, err
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	confirmRequest := &cognito.ConfirmForgotPasswordInput{
+		ClientId:         aws.String(*info.ClientID),
+		Username:         aws.String(email),
+		ConfirmationCode: aws.String(request.Code),
+		Password:         aws.String(request.Password),
+	}
+
+	log.Infow("Cognito ConfirmForgotPassword Request", "Email", email)
+
+	_, err = oauth.NewCognitoClient().ConfirmForgotPassword(confirmRequest)
+	if err != nil {
+		log.Errorw("Cognito ConfirmForgotPassword Error", "Error", err)
+		return nil, oauth.CodeError(err)
+	}
+
+	log.Infow("password reset", "Email", email)
+
+	return &ConfirmForgotPasswordResponse{Status: "password_reset"}, nil
+}
+
+func main() {
+	lambda.Start(ConfirmForgotPassword)
+}
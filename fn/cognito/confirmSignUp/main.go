@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+type ConfirmSignUpRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type ConfirmSignUpResponse struct {
+	Status string `json:"status"`
+}
+
+func ConfirmSignUp(ctx context.Context, request *ConfirmSignUpRequest) (*ConfirmSignUpResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	email := util.NormalizeEmail(request.Email)
+
+	log.Infow("ConfirmSignUp()", "Email", email)
+
+	if err := util.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+	if err := util.ValidateCode(request.Code); err != nil {
+		return nil, err
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	confirmSignUpRequest := &cognito.ConfirmSignUpInput{
+		ClientId:         aws.String(*info.ClientID),
+		Username:         aws.String(email),
+		ConfirmationCode: aws.String(request.Code),
+	}
+
+	log.Infow("Cognito ConfirmSignUp Request", "Email", email)
+
+	_, err = oauth.NewCognitoClient().ConfirmSignUp(confirmSignUpRequest)
+	if err != nil {
+		log.Errorw("Cognito ConfirmSignUp Error", "Error", err)
+		return nil, oauth.CodeError(err)
+	}
+
+	log.Infow("sign up confirmed", "Email", email)
+
+	return &ConfirmSignUpResponse{Status: "confirmed"}, nil
+}
+
+func main() {
+	lambda.Start(ConfirmSignUp)
+}
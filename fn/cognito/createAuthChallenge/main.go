@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/satori/go.uuid"
+	"go.smartmachine.io/awsci-api/pkg/mail"
+	"go.uber.org/zap"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	magicLinkURL = "https://awsci.io/magic-link"
+
+	// linkValidity is how long a magic link can be used for.
+	linkValidity = 15 * time.Minute
+
+	metadataPrefix = "MAGIC_LINK:"
+)
+
+// sender delivers the magic links, set up by main and replaced by the tests.
+var sender mail.Sender
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html lang="en">
+<body style="font-family:Helvetica,Arial,sans-serif;color:#172b4d">
+<p>Hi,</p>
+<p>Click the button below to sign in to AWSci. The link can be used once and expires in {{.Minutes}} minutes.</p>
+<p style="margin:24px 0"><a href="{{.Link}}" style="background:#0052cc;color:#ffffff;padding:10px 20px;border-radius:3px;text-decoration:none;font-weight:bold">Sign in to AWSci</a></p>
+<p>If you didn't try to sign in, you can safely ignore this email.</p>
+</body>
+</html>`))
+
+// magicLink is what the challenge metadata carries between attempts of the
+// same sign in, so a wrong answer doesn't send another email.
+type magicLink struct {
+	ChallengeId string
+	Code        string
+	ExpiresAt   int64
+}
+
+func (m magicLink) metadata() string {
+	return fmt.Sprintf("%s%s:%s:%d", metadataPrefix, m.ChallengeId, m.Code, m.ExpiresAt)
+}
+
+func (m magicLink) url() string {
+	query := url.Values{}
+	query.Set("challenge", m.ChallengeId)
+	query.Set("code", m.Code)
+	return magicLinkURL + "?" + query.Encode()
+}
+
+func parseMetadata(metadata string) (*magicLink, bool) {
+	if !strings.HasPrefix(metadata, metadataPrefix) {
+		return nil, false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(metadata, metadataPrefix), ":")
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &magicLink{ChallengeId: parts[0], Code: parts[1], ExpiresAt: expiresAt}, true
+}
+
+func newMagicLink() (*magicLink, error) {
+	code := make([]byte, 24)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+
+	return &magicLink{
+		ChallengeId: uuid.NewV4().String(),
+		Code:        base64.RawURLEncoding.EncodeToString(code),
+		ExpiresAt:   time.Now().Add(linkValidity).Unix(),
+	}, nil
+}
+
+func sendMagicLink(sender mail.Sender, email string, link *magicLink) error {
+	html := &bytes.Buffer{}
+	err := emailTemplate.Execute(html, map[string]interface{}{
+		"Link":    link.url(),
+		"Minutes": int(linkValidity.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return sender.Send(mail.Message{
+		To:      email,
+		Subject: "Your AWSci sign in link",
+		HTML:    html.String(),
+		Text:    fmt.Sprintf("Sign in to AWSci by opening %s\n\nThe link expires in %d minutes.", link.url(), int(linkValidity.Minutes())),
+	})
+}
+
+func CreateAuthChallenge(ctx context.Context, event events.CognitoEventUserPoolsCreateAuthChallenge) (events.CognitoEventUserPoolsCreateAuthChallenge, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("CreateAuthChallenge()", "ChallengeName", event.Request.ChallengeName)
+
+	if event.Request.ChallengeName != "CUSTOM_CHALLENGE" {
+		return event, nil
+	}
+
+	var link *magicLink
+	if sessions := event.Request.Session; len(sessions) > 0 {
+		link, _ = parseMetadata(sessions[len(sessions)-1].ChallengeMetadata)
+	}
+
+	if link == nil {
+		var err error
+		link, err = newMagicLink()
+		if err != nil {
+			log.Errorw("unable to generate magic link", "Error", err)
+			return event, err
+		}
+
+		// Unverified addresses still get a challenge, so the response doesn't
+		// reveal anything, but never a link
+		email := event.Request.UserAttributes["email"]
+		if email != "" && event.Request.UserAttributes["email_verified"] == "true" {
+			if err = sendMagicLink(sender, email, link); err != nil {
+				log.Errorw("unable to send magic link", "Error", err)
+				return event, err
+			}
+			log.Infow("magic link sent", "ChallengeId", link.ChallengeId)
+		} else {
+			log.Infow("magic link not sent, email unverified", "ChallengeId", link.ChallengeId)
+		}
+	}
+
+	event.Response.PublicChallengeParameters = map[string]string{
+		"challenge_id": link.ChallengeId,
+		"delivery":     "EMAIL",
+	}
+	event.Response.PrivateChallengeParameters = map[string]string{
+		"code":       link.Code,
+		"expires_at": strconv.FormatInt(link.ExpiresAt, 10),
+	}
+	event.Response.ChallengeMetadata = link.metadata()
+
+	return event, nil
+}
+
+func main() {
+	sender = mail.NewSender()
+	lambda.Start(CreateAuthChallenge)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"go.smartmachine.io/awsci-api/pkg/mail"
+	"strings"
+	"testing"
+)
+
+func challengeEvent(attributes map[string]string, sessions ...*events.CognitoEventUserPoolsChallengeResult) events.CognitoEventUserPoolsCreateAuthChallenge {
+	event := events.CognitoEventUserPoolsCreateAuthChallenge{}
+	event.UserName = "5f1a3f2e-8c2b-4b5e-9d1f-2a7c3e9b6d40"
+	event.TriggerSource = "CreateAuthChallenge_Authentication"
+	event.Request.UserAttributes = attributes
+	event.Request.ChallengeName = "CUSTOM_CHALLENGE"
+	event.Request.Session = sessions
+	return event
+}
+
+func TestCreateAuthChallengeSendsLink(t *testing.T) {
+	stub := &mail.StubSender{}
+	sender = stub
+
+	event, err := CreateAuthChallenge(context.Background(), challengeEvent(map[string]string{
+		"email":          "jane@awsci.io",
+		"email_verified": "true",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := stub.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d emails, want 1", len(messages))
+	}
+	if messages[0].To != "jane@awsci.io" {
+		t.Errorf("email sent to %q, want jane@awsci.io", messages[0].To)
+	}
+
+	challengeId := event.Response.PublicChallengeParameters["challenge_id"]
+	code := event.Response.PrivateChallengeParameters["code"]
+	if challengeId == "" || code == "" {
+		t.Fatalf("challenge parameters missing: %v %v", event.Response.PublicChallengeParameters, event.Response.PrivateChallengeParameters)
+	}
+
+	link := (&magicLink{ChallengeId: challengeId, Code: code}).url()
+	if !strings.Contains(messages[0].Text, link) {
+		t.Errorf("text email doesn't carry the link %s:\n%s", link, messages[0].Text)
+	}
+	if !strings.Contains(messages[0].HTML, strings.Replace(link, "&", "&amp;", -1)) {
+		t.Errorf("HTML email doesn't carry the link %s:\n%s", link, messages[0].HTML)
+	}
+
+	// A wrong answer gets another attempt at the same link, not a new email
+	retry, err := CreateAuthChallenge(context.Background(), challengeEvent(map[string]string{
+		"email":          "jane@awsci.io",
+		"email_verified": "true",
+	}, &events.CognitoEventUserPoolsChallengeResult{
+		ChallengeName:     "CUSTOM_CHALLENGE",
+		ChallengeMetadata: event.Response.ChallengeMetadata,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(stub.Messages()); n != 1 {
+		t.Errorf("got %d emails after a retry, want 1", n)
+	}
+	if got := retry.Response.PrivateChallengeParameters["code"]; got != code {
+		t.Errorf("retry changed the code to %q, want %q", got, code)
+	}
+}
+
+func TestCreateAuthChallengeUnverifiedEmail(t *testing.T) {
+	stub := &mail.StubSender{}
+	sender = stub
+
+	event, err := CreateAuthChallenge(context.Background(), challengeEvent(map[string]string{
+		"email":          "jane@awsci.io",
+		"email_verified": "false",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(stub.Messages()); n != 0 {
+		t.Errorf("got %d emails for an unverified address, want 0", n)
+	}
+	if event.Response.PublicChallengeParameters["challenge_id"] == "" {
+		t.Error("unverified address got no challenge")
+	}
+}
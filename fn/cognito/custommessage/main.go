@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+	"html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	baseURL       = "https://awsci.io"
+	defaultLocale = "en"
+)
+
+// templateData is what every template is rendered with. Code and Username
+// are the placeholders Cognito substitutes after the trigger returns.
+type templateData struct {
+	Name     string
+	Code     string
+	Username string
+	link     string
+}
+
+type buttonData struct {
+	Link  string
+	Label string
+}
+
+// Button lets templates render the shared call to action for this message.
+func (d templateData) Button(label string) buttonData {
+	return buttonData{Link: d.link, Label: label}
+}
+
+type layoutData struct {
+	Locale  string
+	Subject string
+	BaseURL string
+	Content template.HTML
+	Footer  string
+}
+
+// locale picks the templates for the user's locale attribute, so "de-AT"
+// gets the German ones and anything unknown falls back to English.
+func locale(attributes map[string]interface{}) string {
+	value, _ := attributes["locale"].(string)
+	value = strings.ToLower(strings.TrimSpace(value))
+	if i := strings.IndexAny(value, "-_"); i >= 0 {
+		value = value[:i]
+	}
+	if _, ok := messages[value]; ok {
+		return value
+	}
+	return defaultLocale
+}
+
+func attribute(attributes map[string]interface{}, name string) string {
+	value, _ := attributes[name].(string)
+	return value
+}
+
+func link(trigger string, attributes map[string]interface{}) string {
+	path, ok := paths[trigger]
+	if !ok {
+		return baseURL
+	}
+	query := url.Values{}
+	if email := attribute(attributes, "email"); email != "" {
+		query.Set("email", email)
+	}
+	if len(query) == 0 {
+		return baseURL + path
+	}
+	return baseURL + path + "?" + query.Encode()
+}
+
+func renderText(name, text string, data templateData) (string, error) {
+	t, err := texttemplate.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	return buf.String(), err
+}
+
+func renderHTML(name, body string, data interface{}) (string, error) {
+	t, err := template.New(name).Parse(button)
+	if err == nil {
+		t, err = t.Parse(body)
+	}
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	return buf.String(), err
+}
+
+// render produces the subject, HTML email and SMS for a trigger source
+// (without the CustomMessage_ prefix) in the given locale.
+func render(trigger, lang string, data templateData) (events.CognitoEventUserPoolsCustomMessageResponse, error) {
+	response := events.CognitoEventUserPoolsCustomMessageResponse{}
+
+	msg, ok := messages[lang][trigger]
+	if !ok {
+		return response, fmt.Errorf("no %s template for %s", lang, trigger)
+	}
+
+	subject, err := renderText("subject", msg.Subject, data)
+	if err != nil {
+		return response, err
+	}
+
+	sms, err := renderText("sms", msg.SMS, data)
+	if err != nil {
+		return response, err
+	}
+
+	content, err := renderHTML("body", msg.Body, data)
+	if err != nil {
+		return response, err
+	}
+
+	email, err := renderHTML("layout", layout, layoutData{
+		Locale:  lang,
+		Subject: subject,
+		BaseURL: baseURL,
+		Content: template.HTML(content),
+		Footer:  footers[lang],
+	})
+	if err != nil {
+		return response, err
+	}
+
+	response.EmailSubject = subject
+	response.EmailMessage = email
+	response.SMSMessage = sms
+
+	return response, nil
+}
+
+func CustomMessage(ctx context.Context, event events.CognitoEventUserPoolsCustomMessage) (events.CognitoEventUserPoolsCustomMessage, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("CustomMessage()")
+
+	trigger := strings.TrimPrefix(event.TriggerSource, "CustomMessage_")
+	if alias, ok := aliases[trigger]; ok {
+		trigger = alias
+	}
+
+	attributes := event.Request.UserAttributes
+	lang := locale(attributes)
+
+	name := attribute(attributes, "given_name")
+	if name == "" {
+		name = attribute(attributes, "name")
+	}
+	if name == "" {
+		name = event.UserName
+	}
+
+	data := templateData{
+		Name:     name,
+		Code:     event.Request.CodeParameter,
+		Username: event.Request.UsernameParameter,
+		link:     link(trigger, attributes),
+	}
+
+	// Leaving the response empty makes Cognito fall back to its default
+	// message, which beats not sending one at all
+	response, err := render(trigger, lang, data)
+	if err != nil {
+		log.Errorw("unable to render custom message", "Locale", lang, "Error", err)
+		return event, nil
+	}
+
+	event.Response = response
+
+	log.Infow("custom message rendered", "Locale", lang, "Subject", response.EmailSubject)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(CustomMessage)
+}
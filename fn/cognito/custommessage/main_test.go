@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, rewriting it instead with -update.
+func golden(t *testing.T, name, got string) {
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the rendered message (run go test -update if the change is intended):\n%s", path, got)
+	}
+}
+
+// TestTemplates renders every template of every locale the way Cognito
+// triggers them and checks the result against its golden file.
+func TestTemplates(t *testing.T) {
+	for lang, triggers := range messages {
+		for trigger := range triggers {
+			lang, trigger := lang, trigger
+			t.Run(lang+"/"+trigger, func(t *testing.T) {
+				event := events.CognitoEventUserPoolsCustomMessage{
+					CognitoEventUserPoolsHeader: events.CognitoEventUserPoolsHeader{
+						TriggerSource: "CustomMessage_" + trigger,
+						UserName:      "5f1a3f2e-8c2b-4b5e-9d1f-2a7c3e9b6d40",
+					},
+					Request: events.CognitoEventUserPoolsCustomMessageRequest{
+						UserAttributes: map[string]interface{}{
+							"email":      "jane@awsci.io",
+							"given_name": "Jane",
+							"locale":     lang,
+						},
+						CodeParameter:     "{####}",
+						UsernameParameter: "{username}",
+					},
+				}
+
+				response, err := CustomMessage(context.Background(), event)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				message := response.Response
+				if message.EmailMessage == "" {
+					t.Fatal("no email rendered")
+				}
+
+				// Cognito rejects messages that lose its placeholders
+				if !strings.Contains(message.EmailMessage, "{####}") {
+					t.Error("email is missing the code placeholder")
+				}
+				if trigger == "AdminCreateUser" && !strings.Contains(message.EmailMessage, "{username}") {
+					t.Error("email is missing the username placeholder")
+				}
+
+				golden(t, fmt.Sprintf("%s_%s.golden", lang, trigger), fmt.Sprintf("Subject: %s\nSMS: %s\n\n%s\n",
+					message.EmailSubject, message.SMSMessage, message.EmailMessage))
+			})
+		}
+	}
+}
+
+// TestAliases checks trigger sources sharing wording render the same message.
+func TestAliases(t *testing.T) {
+	for alias, trigger := range aliases {
+		data := templateData{Name: "Jane", Code: "{####}", Username: "{username}", link: baseURL}
+
+		want, err := render(trigger, defaultLocale, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event := events.CognitoEventUserPoolsCustomMessage{}
+		event.TriggerSource = "CustomMessage_" + alias
+		event.UserName = "Jane"
+		event.Request.CodeParameter = "{####}"
+		event.Request.UsernameParameter = "{username}"
+
+		response, err := CustomMessage(context.Background(), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Response.EmailSubject != want.EmailSubject {
+			t.Errorf("%s: got subject %q, want %q", alias, response.Response.EmailSubject, want.EmailSubject)
+		}
+	}
+}
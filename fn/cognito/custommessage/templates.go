@@ -0,0 +1,150 @@
+package main
+
+// message holds the templates for one trigger source in one locale. Subject
+// and SMS are text templates, Body is an HTML template rendered into layout.
+type message struct {
+	Subject string
+	Body    string
+	SMS     string
+}
+
+const layout = `<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="margin:0;padding:0;background:#f4f5f7;font-family:Helvetica,Arial,sans-serif;color:#172b4d">
+<table width="100%" cellpadding="0" cellspacing="0" role="presentation">
+<tr><td align="center" style="padding:32px 16px">
+<table width="560" cellpadding="0" cellspacing="0" role="presentation" style="background:#ffffff;border-radius:4px">
+<tr><td style="padding:24px 32px;border-bottom:1px solid #dfe1e6">
+<a href="{{.BaseURL}}" style="font-size:20px;font-weight:bold;color:#0052cc;text-decoration:none">AWSci</a>
+</td></tr>
+<tr><td style="padding:32px;font-size:15px;line-height:1.5">
+{{.Content}}
+</td></tr>
+<tr><td style="padding:16px 32px;font-size:12px;color:#6b778c;border-top:1px solid #dfe1e6">
+{{.Footer}} <a href="{{.BaseURL}}" style="color:#6b778c">awsci.io</a>
+</td></tr>
+</table>
+</td></tr>
+</table>
+</body>
+</html>`
+
+// footers are shown at the bottom of every email.
+var footers = map[string]string{
+	"en": "You received this email because of your account at",
+	"de": "Sie erhalten diese E-Mail aufgrund Ihres Kontos bei",
+}
+
+// button renders a call to action, shared by every template.
+const button = `{{define "button"}}<p style="margin:24px 0"><a href="{{.Link}}" style="background:#0052cc;color:#ffffff;padding:10px 20px;border-radius:3px;text-decoration:none;font-weight:bold">{{.Label}}</a></p>{{end}}`
+
+// messages are keyed by locale, then by trigger source without the
+// CustomMessage_ prefix. Cognito requires the code placeholder to appear
+// in the email verbatim, so it is never part of a link.
+var messages = map[string]map[string]message{
+	"en": {
+		"SignUp": {
+			Subject: "Confirm your AWSci account",
+			Body: `<p>Hi {{.Name}},</p>
+<p>Thanks for signing up to AWSci. Your confirmation code is:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "Confirm your account"}}
+<p>If you didn't sign up, you can safely ignore this email.</p>`,
+			SMS: "Your AWSci confirmation code is {{.Code}}",
+		},
+		"ForgotPassword": {
+			Subject: "Reset your AWSci password",
+			Body: `<p>Hi {{.Name}},</p>
+<p>We received a request to reset your password. Your reset code is:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "Choose a new password"}}
+<p>If you didn't ask to reset your password, you can safely ignore this email.</p>`,
+			SMS: "Your AWSci password reset code is {{.Code}}",
+		},
+		"UpdateUserAttribute": {
+			Subject: "Verify your new AWSci email address",
+			Body: `<p>Hi {{.Name}},</p>
+<p>Please verify this email address for your AWSci account with the code:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "Verify email address"}}`,
+			SMS: "Your AWSci verification code is {{.Code}}",
+		},
+		"AdminCreateUser": {
+			Subject: "You have been invited to AWSci",
+			Body: `<p>Hi {{.Name}},</p>
+<p>An account has been created for you at AWSci.</p>
+<p>Username: <strong>{{.Username}}</strong><br>Temporary password: <strong>{{.Code}}</strong></p>
+{{template "button" .Button "Sign in"}}
+<p>You will be asked to choose a new password when you first sign in.</p>`,
+			SMS: "Your AWSci username is {{.Username}} and temporary password is {{.Code}}",
+		},
+		"Authentication": {
+			Subject: "Your AWSci sign in code",
+			Body: `<p>Hi {{.Name}},</p>
+<p>Your sign in code is:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+<p>If you aren't trying to sign in, please change your password.</p>`,
+			SMS: "Your AWSci sign in code is {{.Code}}",
+		},
+	},
+	"de": {
+		"SignUp": {
+			Subject: "Bestätigen Sie Ihr AWSci-Konto",
+			Body: `<p>Hallo {{.Name}},</p>
+<p>Vielen Dank für Ihre Registrierung bei AWSci. Ihr Bestätigungscode lautet:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "Konto bestätigen"}}
+<p>Falls Sie sich nicht registriert haben, können Sie diese E-Mail ignorieren.</p>`,
+			SMS: "Ihr AWSci-Bestätigungscode lautet {{.Code}}",
+		},
+		"ForgotPassword": {
+			Subject: "Setzen Sie Ihr AWSci-Passwort zurück",
+			Body: `<p>Hallo {{.Name}},</p>
+<p>Wir haben eine Anfrage zum Zurücksetzen Ihres Passworts erhalten. Ihr Code lautet:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "Neues Passwort wählen"}}
+<p>Falls Sie dies nicht angefordert haben, können Sie diese E-Mail ignorieren.</p>`,
+			SMS: "Ihr AWSci-Code zum Zurücksetzen des Passworts lautet {{.Code}}",
+		},
+		"UpdateUserAttribute": {
+			Subject: "Bestätigen Sie Ihre neue E-Mail-Adresse bei AWSci",
+			Body: `<p>Hallo {{.Name}},</p>
+<p>Bitte bestätigen Sie diese E-Mail-Adresse für Ihr AWSci-Konto mit dem Code:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+{{template "button" .Button "E-Mail-Adresse bestätigen"}}`,
+			SMS: "Ihr AWSci-Bestätigungscode lautet {{.Code}}",
+		},
+		"AdminCreateUser": {
+			Subject: "Sie wurden zu AWSci eingeladen",
+			Body: `<p>Hallo {{.Name}},</p>
+<p>Für Sie wurde ein Konto bei AWSci angelegt.</p>
+<p>Benutzername: <strong>{{.Username}}</strong><br>Vorläufiges Passwort: <strong>{{.Code}}</strong></p>
+{{template "button" .Button "Anmelden"}}
+<p>Bei der ersten Anmeldung werden Sie gebeten, ein neues Passwort zu wählen.</p>`,
+			SMS: "Ihr AWSci-Benutzername ist {{.Username}}, Ihr vorläufiges Passwort {{.Code}}",
+		},
+		"Authentication": {
+			Subject: "Ihr AWSci-Anmeldecode",
+			Body: `<p>Hallo {{.Name}},</p>
+<p>Ihr Anmeldecode lautet:</p>
+<p style="font-size:24px;font-weight:bold;letter-spacing:4px">{{.Code}}</p>
+<p>Falls Sie sich nicht anmelden wollten, ändern Sie bitte Ihr Passwort.</p>`,
+			SMS: "Ihr AWSci-Anmeldecode lautet {{.Code}}",
+		},
+	},
+}
+
+// aliases map trigger sources that share their wording with another one.
+var aliases = map[string]string{
+	"ResendCode":          "SignUp",
+	"VerifyUserAttribute": "UpdateUserAttribute",
+}
+
+// paths are the pages on our domain each trigger source links to.
+var paths = map[string]string{
+	"SignUp":              "/confirm",
+	"ForgotPassword":      "/reset-password",
+	"UpdateUserAttribute": "/verify-email",
+	"AdminCreateUser":     "/login",
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+)
+
+// maxAttempts is how many wrong answers a magic link sign in survives.
+const maxAttempts = 3
+
+func DefineAuthChallenge(ctx context.Context, event events.CognitoEventUserPoolsDefineAuthChallenge) (events.CognitoEventUserPoolsDefineAuthChallenge, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	sessions := event.Request.Session
+
+	log.Infow("DefineAuthChallenge()", "Attempts", len(sessions))
+
+	switch {
+	case len(sessions) == 0:
+		event.Response.ChallengeName = "CUSTOM_CHALLENGE"
+	case sessions[len(sessions)-1].ChallengeName != "CUSTOM_CHALLENGE":
+		// Magic links are the only custom flow, nothing else may lead here
+		event.Response.FailAuthentication = true
+	case sessions[len(sessions)-1].ChallengeResult:
+		event.Response.IssueTokens = true
+	case len(sessions) >= maxAttempts:
+		event.Response.FailAuthentication = true
+	default:
+		event.Response.ChallengeName = "CUSTOM_CHALLENGE"
+	}
+
+	log.Infow("auth challenge defined", "Response", event.Response)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(DefineAuthChallenge)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.uber.org/zap"
+	"net/url"
+)
+
+// DeviceCodeRequest starts a device authorization for a CLI, RFC 8628
+// section 3.1.
+type DeviceCodeRequest struct {
+	oauth.ClientContext
+}
+
+// DeviceCodeResponse is the device authorization response of RFC 8628
+// section 3.2.
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func DeviceCode(ctx context.Context, request *DeviceCodeRequest) (*DeviceCodeResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("DeviceCode()", "UserAgent", request.UserAgent, "SourceIP", request.SourceIP)
+
+	deviceCode, device, err := oauth.NewDeviceAuthorization(request.ClientContext)
+	if err != nil {
+		log.Errorw("unable to start device authorization", "Error", err)
+		return nil, err
+	}
+
+	userCode := oauth.FormatUserCode(device.UserCode)
+
+	log.Infow("device authorization started", "UserCode", userCode)
+
+	return &DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         oauth.VerificationURI,
+		VerificationURIComplete: oauth.VerificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int64(oauth.DeviceCodeValidity.Seconds()),
+		Interval:                device.Interval,
+	}, nil
+}
+
+func main() {
+	lambda.Start(DeviceCode)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+// DeviceTokenRequest is a device polling for its tokens, either as JSON or
+// as the form Body of an RFC 8628 section 3.4 device_code grant.
+type DeviceTokenRequest struct {
+	oauth.ClientContext
+	GrantType  string `json:"grant_type"`
+	DeviceCode string `json:"device_code"`
+	Body       string `json:"body"`
+}
+
+type DeviceTokenResponse struct {
+	*oauth.TokenResponse
+}
+
+func DeviceToken(ctx context.Context, request *DeviceTokenRequest) (*DeviceTokenResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("DeviceToken()", "UserAgent", request.UserAgent, "SourceIP", request.SourceIP)
+
+	var err error
+	if request.Body != "" {
+		request.GrantType = oauth.GrantTypeDeviceCode
+		request.DeviceCode, err = oauth.ParseDeviceTokenForm(request.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if request.GrantType != oauth.GrantTypeDeviceCode {
+		return nil, oauth.ErrUnsupportedGrantType
+	}
+	if request.DeviceCode == "" {
+		return nil, util.NewError("device_code is required", 400)
+	}
+
+	sessionId, err := oauth.PollDeviceAuthorization(request.DeviceCode)
+	if err != nil {
+		log.Infow("device not authorized", "Error", err)
+		return nil, err
+	}
+
+	cognitoSession, err := oauth.GetSessionById(sessionId)
+	if err != nil {
+		log.Errorw("unable to find device session", "SessionId", sessionId, "Error", err)
+		return nil, err
+	}
+
+	credential, err := cognitoSession.IssueSession()
+	if err != nil {
+		log.Errorw("unable to issue refresh credential", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("device signed in", "User", cognitoSession.User, "SessionId", sessionId)
+
+	return &DeviceTokenResponse{
+		TokenResponse: cognitoSession.TokenResponse(credential),
+	}, nil
+}
+
+func main() {
+	lambda.Start(DeviceToken)
+}
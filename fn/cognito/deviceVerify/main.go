@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+// DeviceVerifyRequest is the verification page. The UserCode alone looks
+// the device up so the user can check it, Deny turns it down, both for a
+// signed in user. The Code of a hosted UI sign in approves it, along with
+// the State of the authorize call that started it, made with the user code
+// as its nonce.
+type DeviceVerifyRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+	UserCode    string  `json:"user_code"`
+	Code        string  `json:"code"`
+	State       string  `json:"state"`
+	Deny        bool    `json:"deny"`
+}
+
+type DeviceVerifyResponse struct {
+	Status    string `json:"status"`
+	UserCode  string `json:"user_code"`
+	UserAgent string `json:"user_agent,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+}
+
+func DeviceVerify(ctx context.Context, request *DeviceVerifyRequest) (*DeviceVerifyResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("DeviceVerify()", "UserCode", request.UserCode, "Deny", request.Deny)
+
+	if request.UserCode == "" {
+		return nil, util.NewError("user_code is required", 400)
+	}
+
+	// Showing or turning down a device is for the signed in user only, the
+	// user code alone is easily guessed
+	if request.Code == "" {
+		if _, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true); err != nil {
+			log.Errorw("unable to authenticate", "Error", err)
+			return nil, err
+		}
+	}
+
+	device, err := oauth.GetDeviceAuthorization(request.UserCode)
+	if err != nil {
+		log.Infow("device authorization not found", "UserCode", request.UserCode, "Error", err)
+		return nil, err
+	}
+
+	// Only the sign in started for this very device may approve it, so a
+	// code from another sign in can't be slipped in
+	if request.Code != "" {
+		nonce, redirectURI, client, err := oauth.ParseAuthState(request.State)
+		if err != nil {
+			return nil, err
+		}
+		if oauth.NormalizeUserCode(nonce) != device.UserCode {
+			log.Warnw("state doesn't belong to the device", "UserCode", request.UserCode)
+			return nil, util.NewError("state is invalid", 400)
+		}
+		if err = oauth.CheckRedirectURI(redirectURI, client); err != nil {
+			log.Warnw("redirect uri rejected", "RedirectURI", redirectURI, "Client", client, "Error", err)
+			return nil, err
+		}
+	}
+
+	switch {
+	case request.Deny:
+		if err = device.Deny(); err != nil {
+			log.Errorw("unable to deny device", "Error", err)
+			return nil, err
+		}
+
+	case request.Code != "":
+		// The device gets a sign in of its own, so it can be signed out
+		// without touching the browser session
+		ciSession, err := oauth.ExchangeCode(ctx, request.Code, oauth.ProviderDevice, oauth.ClientContext{
+			UserAgent: device.UserAgent,
+			SourceIP:  device.SourceIP,
+		})
+		if err != nil {
+			log.Errorw("unable to exchange code", "Error", err)
+			return nil, err
+		}
+
+		if err = ciSession.SaveSession(); err != nil {
+			return nil, err
+		}
+
+		if err = device.Approve(ciSession.SessionId); err != nil {
+			log.Errorw("unable to approve device", "Error", err)
+			if revokeErr := ciSession.Revoke(ctx); revokeErr != nil {
+				log.Errorw("unable to revoke device session", "SessionId", ciSession.SessionId, "Error", revokeErr)
+			}
+			return nil, err
+		}
+
+		log.Infow("device approved", "User", ciSession.User, "SessionId", ciSession.SessionId)
+	}
+
+	return &DeviceVerifyResponse{
+		Status:    device.Status,
+		UserCode:  oauth.FormatUserCode(device.UserCode),
+		UserAgent: device.UserAgent,
+		SourceIP:  device.SourceIP,
+	}, nil
+}
+
+func main() {
+	lambda.Start(DeviceVerify)
+}
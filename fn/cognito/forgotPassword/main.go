@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ForgotPasswordResponse struct {
+	Status string `json:"status"`
+}
+
+func ForgotPassword(ctx context.Context, request *ForgotPasswordRequest) (*ForgotPasswordResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	email := util.NormalizeEmail(request.Email)
+
+	log.Infow("ForgotPassword()", "Email", email)
+
+	if err := util.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	forgotPasswordRequest := &cognito.ForgotPasswordInput{
+		ClientId: aws.String(*info.ClientID),
+		Username: aws.String(email),
+	}
+
+	log.Infow("Cognito ForgotPassword Request", "Email", email)
+
+	// The delivery destination is left out too, it would only be there for
+	// users that exist
+	sent := &ForgotPasswordResponse{Status: "sent"}
+
+	_, err = oauth.NewCognitoClient().ForgotPassword(forgotPasswordRequest)
+	if oauth.IsCognitoError(err, cognito.ErrCodeUserNotFoundException) ||
+		oauth.IsCognitoError(err, cognito.ErrCodeNotAuthorizedException) ||
+		oauth.IsCognitoError(err, cognito.ErrCodeInvalidParameterException) {
+		log.Infow("password reset not started", "Email", email, "Error", err)
+		return sent, nil
+	}
+	if err != nil {
+		log.Errorw("Cognito ForgotPassword Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("password reset code sent", "Email", email)
+
+	return sent, nil
+}
+
+func main() {
+	lambda.Start(ForgotPassword)
+}
@@ -12,6 +12,8 @@ import (
 type ClientInfoResponse struct {
 	ClientId *string `json:"client_id"`
 	CallbackURL *string `json:"callback_url"`
+	RedirectURIs []string `json:"redirect_uris"`
+	LogoutURIs []string `json:"logout_uris"`
 }
 
 func ClientInfo(ctx context.Context, request interface{}) (*ClientInfoResponse, error) {
@@ -32,6 +34,8 @@ func ClientInfo(ctx context.Context, request interface{}) (*ClientInfoResponse,
 	return &ClientInfoResponse{
 		ClientId:    info.ClientID,
 		CallbackURL: info.CallbackURL,
+		RedirectURIs: info.AllowedRedirectURIs(),
+		LogoutURIs:  info.LogoutURIs,
 	}, nil
 
 }
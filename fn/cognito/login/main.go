@@ -2,23 +2,30 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/aws/aws-lambda-go/lambda"
 	"go.smartmachine.io/awsci-api/pkg/oauth"
-	"go.smartmachine.io/awsci-api/pkg/ssm"
 	"go.smartmachine.io/awsci-api/pkg/util"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
-	"io/ioutil"
 )
 
+// LoginRequest exchanges the hosted UI Code, along with the State made by
+// authorize. With Cookie set the session is handed to the browser as cookies
+// instead of returning the access token.
 type LoginRequest struct {
-	Code string `json:"code"`
+	oauth.ClientContext
+	Code   string `json:"code"`
+	State  string `json:"state"`
+	Cookie bool   `json:"cookie"`
 }
 
+// LoginResponse is either a token response, or the cookies of a browser
+// session, and where to send the user next.
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
+	*oauth.TokenResponse
+	SetCookie   []string `json:"set_cookie,omitempty"`
+	CSRFToken   string   `json:"csrf_token,omitempty"`
+	RedirectURI string   `json:"redirect_uri,omitempty"`
+	State       string   `json:"state,omitempty"`
 }
 
 func Login(ctx context.Context, request *LoginRequest) (*LoginResponse, error) {
@@ -29,83 +36,63 @@ func Login(ctx context.Context, request *LoginRequest) (*LoginResponse, error) {
 	log := logger.Sugar()
 
 
-	log.Infow("Login()", "Request", request)
+	// The code, state and CSRF token are secrets, only log what identifies
+	// the request
+	log.Infow("Login()", "UserAgent", request.UserAgent, "SourceIP", request.SourceIP, "Cookie", request.Cookie)
 
 	if request.Code == "" {
 		return nil, util.NewError("code is invalid", 400)
 	}
 
-	info, err := ssm.GetClientInfo()
-	if err != nil {
-		return nil, err
-	}
-
-	log.Infow("retrieved client info", "Info", info)
+	var err error
+	response := &LoginResponse{}
 
-	cognitoConfig, err := oauth.NewCognitoConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	token, err := cognitoConfig.Exchange(ctx, request.Code)
-	if err != nil {
-		if _, ok := err.(*oauth2.RetrieveError); ok {
-			return nil, fmt.Errorf("oauth2 token exchange error")
+	// The redirect URI came back through the browser, it is checked again
+	// rather than trusted
+	if request.State != "" {
+		client := ""
+		response.State, response.RedirectURI, client, err = oauth.ParseAuthState(request.State)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf(err.Error())
-	}
-
-	log.Infow("obtained token", "Token", token)
-
-	tokenSource := cognitoConfig.TokenSource(ctx, token)
-	oauthClient := oauth2.NewClient(ctx, tokenSource)
-
-	resp, err := oauthClient.Get("https://auth.awsci.io/oauth2/userInfo")
 
-	if err != nil {
-		return nil, util.NewError(fmt.Sprintf("cognito userInfo failed: %+v", err), 400)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Errorw("error reading body", "Error", err)
-		return nil, err
+		if err = oauth.CheckRedirectURI(response.RedirectURI, client); err != nil {
+			log.Warnw("redirect uri rejected", "RedirectURI", response.RedirectURI, "Client", client, "Error", err)
+			return nil, err
+		}
 	}
 
-	userInfo := make(map[string]interface{})
-	err = json.Unmarshal(body, &userInfo)
+	ciSession, err := oauth.ExchangeCode(ctx, request.Code, oauth.ProviderHostedUI, request.ClientContext)
 	if err != nil {
-		log.Errorw("error unmarshalling json", "Error", err)
 		return nil, err
 	}
 
-	log.Infow("Cognito userInfo", "userInfo", userInfo)
-	user := userInfo["username"].(string)
+	if request.Cookie {
+		cookies, csrfToken, err := ciSession.NewSessionCookies()
+		if err != nil {
+			log.Errorw("unable to create session cookies", "Error", err)
+			return nil, err
+		}
 
-	curTok, err := tokenSource.Token()
-	if err != nil {
-		return nil, err
-	}
+		if err = ciSession.SaveSession(); err != nil {
+			return nil, err
+		}
 
-	log.Infow("current token", "Token", curTok )
+		response.SetCookie = cookies
+		response.CSRFToken = csrfToken
 
-	ciSession := oauth.CognitoSession{
-		User:         user,
-		AccessToken:  curTok.AccessToken,
-		TokenType:    curTok.TokenType,
-		RefreshToken: curTok.RefreshToken,
-		Expiry:       curTok.Expiry,
+		return response, nil
 	}
 
-	err = ciSession.SaveSession()
+	credential, err := ciSession.IssueSession()
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoginResponse{
-		AccessToken: curTok.AccessToken,
-	}, nil
+	response.TokenResponse = ciSession.TokenResponse(credential)
+
+	return response, nil
 
 }
 
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+// LogoutRequest signs out the session making the request. With LogoutURI,
+// which has to be on the allowlist of the app client named Client, or of
+// the web client without one, the user is also signed out of the hosted UI.
+// The hosted UI only returns to the registered sign out URL, so the page
+// there passes the State it got back to have it turned into LogoutURI.
+type LogoutRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+	LogoutURI   string  `json:"logout_uri"`
+	Client      string  `json:"client"`
+	State       string  `json:"state"`
+}
+
+type LogoutResponse struct {
+	LogoutURL   string   `json:"logout_url,omitempty"`
+	State       string   `json:"state,omitempty"`
+	RedirectURI string   `json:"redirect_uri,omitempty"`
+	SetCookie   []string `json:"set_cookie,omitempty"`
+}
+
+// completeLogout turns the State of a finished hosted UI sign out into where
+// the user asked to go, checking it again as it came back from the browser.
+func completeLogout(log *zap.SugaredLogger, state string) (*LogoutResponse, error) {
+	_, logoutURI, client, err := oauth.ParseAuthState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = oauth.CheckLogoutURI(logoutURI, client); err != nil {
+		log.Warnw("logout uri rejected", "LogoutURI", logoutURI, "Client", client, "Error", err)
+		return nil, err
+	}
+
+	return &LogoutResponse{RedirectURI: logoutURI}, nil
+}
+
+func Logout(ctx context.Context, request LogoutRequest) (*LogoutResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("Logout()", "LogoutURI", request.LogoutURI, "Client", request.Client)
+
+	if request.State != "" {
+		return completeLogout(log, request.State)
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked first, so a bad logout_uri can't be used to sign anyone out
+	state := ""
+	if request.LogoutURI != "" {
+		if err = oauth.CheckLogoutURI(request.LogoutURI, request.Client); err != nil {
+			log.Warnw("logout uri rejected", "LogoutURI", request.LogoutURI, "Client", request.Client, "Error", err)
+			return nil, err
+		}
+		if info.LogoutURL == nil || *info.LogoutURL == "" {
+			log.Errorw("no sign out url registered", "Parameter", ssm.LogoutURLParameter)
+			return nil, util.NewError("signing out of the hosted UI is unavailable", 500)
+		}
+		if state, err = oauth.NewAuthState("", request.LogoutURI, request.Client); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	if err = current.Revoke(ctx); err != nil {
+		log.Errorw("unable to revoke session", "SessionId", current.SessionId, "Error", err)
+		return nil, err
+	}
+
+	log.Infow("session signed out", "User", current.User, "SessionId", current.SessionId)
+
+	response := &LogoutResponse{}
+	if request.Cookie != "" {
+		response.SetCookie = oauth.ClearSessionCookies()
+	}
+	if request.LogoutURI != "" {
+		response.LogoutURL = oauth.HostedLogoutURL(*info.ClientID, *info.LogoutURL)
+		response.State = state
+	}
+
+	return response, nil
+}
+
+func main() {
+	lambda.Start(Logout)
+}
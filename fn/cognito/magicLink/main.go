@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// sessionValidity is how long Cognito accepts an answer to a challenge.
+const sessionValidity = 15 * time.Minute
+
+// MagicLinkRequest either starts a sign in with Email, or completes it with
+// the ChallengeId and Code from the link.
+type MagicLinkRequest struct {
+	oauth.ClientContext
+	Email       string `json:"email"`
+	ChallengeId string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+type MagicLinkResponse struct {
+	*oauth.TokenResponse
+	Status string `json:"status,omitempty"`
+}
+
+var errInvalidLink = util.NewError("this sign in link is invalid or has expired", 401)
+
+// start asks Cognito for a custom challenge, which makes the create trigger
+// email the link, and keeps the Cognito session for when it is clicked.
+func start(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, clientId, email string) (*MagicLinkResponse, error) {
+	// Every outcome gets the same answer, so it can't be used to find out
+	// who has an account
+	sent := &MagicLinkResponse{Status: "sent"}
+
+	initiateAuthRequest := &cognito.InitiateAuthInput{
+		AuthFlow: aws.String(cognito.AuthFlowTypeCustomAuth),
+		ClientId: aws.String(clientId),
+		AuthParameters: map[string]*string{
+			"USERNAME": aws.String(email),
+		},
+	}
+
+	log.Infow("Cognito InitiateAuth Request", "Email", email)
+
+	initiateAuthResponse, err := svc.InitiateAuth(initiateAuthRequest)
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case cognito.ErrCodeUserNotFoundException, cognito.ErrCodeNotAuthorizedException, cognito.ErrCodeUserNotConfirmedException:
+			log.Infow("magic link not started", "Email", email, "Code", aerr.Code())
+			return sent, nil
+		}
+	}
+	if err != nil {
+		log.Errorw("Cognito InitiateAuth Error", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("Cognito InitiateAuth Response", "ChallengeName", initiateAuthResponse.ChallengeName, "ChallengeParameters", initiateAuthResponse.ChallengeParameters)
+
+	params := aws.StringValueMap(initiateAuthResponse.ChallengeParameters)
+	if aws.StringValue(initiateAuthResponse.ChallengeName) != cognito.ChallengeNameTypeCustomChallenge || params["challenge_id"] == "" {
+		return sent, nil
+	}
+
+	username := params["USERNAME"]
+	if username == "" {
+		username = email
+	}
+
+	challenge := oauth.Challenge{
+		ChallengeId:   params["challenge_id"],
+		ChallengeName: cognito.ChallengeNameTypeCustomChallenge,
+		Username:      username,
+		Session:       aws.StringValue(initiateAuthResponse.Session),
+		ExpiresAt:     time.Now().Add(sessionValidity).Unix(),
+	}
+
+	if err = challenge.SaveChallenge(); err != nil {
+		log.Errorw("unable to save challenge", "Error", err)
+		return nil, err
+	}
+
+	return sent, nil
+}
+
+// complete answers the challenge with the code from the link.
+func complete(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, clientId string, request *MagicLinkRequest) (*MagicLinkResponse, error) {
+	challenge, err := oauth.GetChallenge(request.ChallengeId)
+	if err == oauth.ErrChallengeNotFound {
+		return nil, errInvalidLink
+	}
+	if err != nil {
+		log.Errorw("unable to read challenge", "Error", err)
+		return nil, err
+	}
+
+	respondRequest := &cognito.RespondToAuthChallengeInput{
+		ChallengeName: aws.String(cognito.ChallengeNameTypeCustomChallenge),
+		ClientId:      aws.String(clientId),
+		Session:       aws.String(challenge.Session),
+		ChallengeResponses: map[string]*string{
+			"USERNAME": aws.String(challenge.Username),
+			"ANSWER":   aws.String(request.Code),
+		},
+	}
+
+	log.Infow("Cognito RespondToAuthChallenge Request", "ChallengeId", challenge.ChallengeId, "Username", challenge.Username)
+
+	respondResponse, err := svc.RespondToAuthChallenge(respondRequest)
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case cognito.ErrCodeNotAuthorizedException, cognito.ErrCodeCodeMismatchException, cognito.ErrCodeExpiredCodeException:
+			log.Infow("magic link rejected", "ChallengeId", challenge.ChallengeId, "Code", aerr.Code())
+			oauth.DeleteChallenge(challenge.ChallengeId)
+			return nil, errInvalidLink
+		}
+	}
+	if err != nil {
+		log.Errorw("Cognito RespondToAuthChallenge Error", "Error", err)
+		return nil, err
+	}
+
+	if respondResponse.AuthenticationResult == nil {
+		// A wrong code, Cognito hands out a new session for the next attempt
+		challenge.Session = aws.StringValue(respondResponse.Session)
+		if err = challenge.SaveChallenge(); err != nil {
+			log.Errorw("unable to save challenge", "Error", err)
+			return nil, err
+		}
+		return nil, errInvalidLink
+	}
+
+	log.Infow("Cognito RespondToAuthChallenge Response", "ChallengeId", challenge.ChallengeId)
+
+	// The link is single use, whatever happens next
+	if err = oauth.DeleteChallenge(challenge.ChallengeId); err != nil {
+		log.Errorw("unable to delete challenge", "Error", err)
+	}
+
+	ciSession := oauth.NewCognitoSession(challenge.Username, oauth.ProviderMagicLink, request.ClientContext, respondResponse.AuthenticationResult)
+	credential, err := ciSession.IssueSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MagicLinkResponse{TokenResponse: ciSession.TokenResponse(credential)}, nil
+}
+
+func MagicLink(ctx context.Context, request *MagicLinkRequest) (*MagicLinkResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("MagicLink()", "Email", request.Email, "ChallengeId", request.ChallengeId)
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infow("retrieved client info", "Info", structs.Map(info))
+
+	svc := oauth.NewCognitoClient()
+
+	switch {
+	case request.ChallengeId != "" && request.Code != "":
+		return complete(log, svc, *info.ClientID, request)
+	case strings.Contains(request.Email, "@"):
+		return start(log, svc, *info.ClientID, strings.ToLower(strings.TrimSpace(request.Email)))
+	default:
+		return nil, util.NewError("either email, or challenge_id and code are required", 400)
+	}
+}
+
+func main() {
+	lambda.Start(MagicLink)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+// MfaDisableRequest turns off Method, SOFTWARE_TOKEN_MFA or SMS_MFA.
+type MfaDisableRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+	Method      string  `json:"method"`
+}
+
+type MfaDisableResponse struct {
+	Status string `json:"status"`
+}
+
+func MfaDisable(ctx context.Context, request MfaDisableRequest) (*MfaDisableResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("MfaDisable()", "Method", request.Method)
+
+	disabled := &cognito.SoftwareTokenMfaSettingsType{
+		Enabled:      aws.Bool(false),
+		PreferredMfa: aws.Bool(false),
+	}
+
+	preferenceRequest := &cognito.SetUserMFAPreferenceInput{}
+	switch request.Method {
+	case cognito.ChallengeNameTypeSoftwareTokenMfa:
+		preferenceRequest.SoftwareTokenMfaSettings = disabled
+	case cognito.ChallengeNameTypeSmsMfa:
+		preferenceRequest.SMSMfaSettings = &cognito.SMSMfaSettingsType{
+			Enabled:      disabled.Enabled,
+			PreferredMfa: disabled.PreferredMfa,
+		}
+	default:
+		return nil, util.NewError("method must be SOFTWARE_TOKEN_MFA or SMS_MFA", 400)
+	}
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+	preferenceRequest.AccessToken = aws.String(accessToken)
+
+	log.Infow("Cognito SetUserMFAPreference Request", "Method", request.Method)
+
+	// Cognito refuses this with an InvalidParameterException when the user
+	// pool requires MFA and it is the user's last method
+	_, err = oauth.NewCognitoClient().SetUserMFAPreference(preferenceRequest)
+	if err != nil {
+		log.Errorw("Cognito SetUserMFAPreference Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("MFA method disabled", "Method", request.Method)
+
+	return &MfaDisableResponse{Status: "disabled"}, nil
+}
+
+func main() {
+	lambda.Start(MfaDisable)
+}
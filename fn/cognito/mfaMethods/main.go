@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.uber.org/zap"
+)
+
+type MfaMethodsRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+}
+
+type MfaMethod struct {
+	Method    string `json:"method"`
+	Preferred bool   `json:"preferred"`
+}
+
+type MfaMethodsResponse struct {
+	Methods []MfaMethod `json:"methods"`
+}
+
+func MfaMethods(ctx context.Context, request MfaMethodsRequest) (*MfaMethodsResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("MfaMethods()")
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, false)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+
+	user, err := oauth.NewCognitoClient().GetUser(&cognito.GetUserInput{AccessToken: aws.String(accessToken)})
+	if err != nil {
+		log.Errorw("Cognito GetUser Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	preferred := aws.StringValue(user.PreferredMfaSetting)
+
+	response := &MfaMethodsResponse{Methods: []MfaMethod{}}
+	for _, method := range aws.StringValueSlice(user.UserMFASettingList) {
+		response.Methods = append(response.Methods, MfaMethod{
+			Method:    method,
+			Preferred: method == preferred,
+		})
+	}
+
+	log.Infow("listed MFA methods", "Username", user.Username, "Methods", response.Methods)
+
+	return response, nil
+}
+
+func main() {
+	lambda.Start(MfaMethods)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.uber.org/zap"
+	"net/url"
+	"rsc.io/qr"
+)
+
+// issuer is how authenticator apps label the account.
+const issuer = "AWSci"
+
+type MfaSetupRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+}
+
+// MfaSetupResponse has everything an authenticator app needs, the QR code is
+// a base64 encoded PNG of the URI.
+type MfaSetupResponse struct {
+	SecretCode string `json:"secret_code"`
+	URI        string `json:"uri"`
+	QRCode     string `json:"qr_code"`
+}
+
+// otpauthURI builds the key URI authenticator apps scan, see
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func otpauthURI(account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// accountName labels the account with the user's email if they have one.
+func accountName(user *cognito.GetUserOutput) string {
+	for _, attribute := range user.UserAttributes {
+		if aws.StringValue(attribute.Name) == "email" && aws.StringValue(attribute.Value) != "" {
+			return aws.StringValue(attribute.Value)
+		}
+	}
+	return aws.StringValue(user.Username)
+}
+
+func MfaSetup(ctx context.Context, request MfaSetupRequest) (*MfaSetupResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("MfaSetup()")
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+
+	svc := oauth.NewCognitoClient()
+
+	user, err := svc.GetUser(&cognito.GetUserInput{AccessToken: aws.String(accessToken)})
+	if err != nil {
+		log.Errorw("Cognito GetUser Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("Cognito AssociateSoftwareToken Request", "Username", user.Username)
+
+	associateResponse, err := svc.AssociateSoftwareToken(&cognito.AssociateSoftwareTokenInput{
+		AccessToken: aws.String(accessToken),
+	})
+	if err != nil {
+		log.Errorw("Cognito AssociateSoftwareToken Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	secret := aws.StringValue(associateResponse.SecretCode)
+	uri := otpauthURI(accountName(user), secret)
+
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		log.Errorw("unable to render QR code", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("software token associated", "Username", user.Username)
+
+	return &MfaSetupResponse{
+		SecretCode: secret,
+		URI:        uri,
+		QRCode:     base64.StdEncoding.EncodeToString(code.PNG()),
+	}, nil
+}
+
+func main() {
+	lambda.Start(MfaSetup)
+}
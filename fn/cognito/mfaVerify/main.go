@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+// MfaVerifyRequest confirms the authenticator app set up by mfaSetup with a
+// code it generated.
+type MfaVerifyRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+	Code        string  `json:"code"`
+	DeviceName  string  `json:"device_name"`
+}
+
+type MfaVerifyResponse struct {
+	Status string `json:"status"`
+}
+
+func MfaVerify(ctx context.Context, request MfaVerifyRequest) (*MfaVerifyResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("MfaVerify()", "DeviceName", request.DeviceName)
+
+	if err := util.ValidateCode(request.Code); err != nil {
+		return nil, err
+	}
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+
+	svc := oauth.NewCognitoClient()
+
+	verifyRequest := &cognito.VerifySoftwareTokenInput{
+		AccessToken: aws.String(accessToken),
+		UserCode:    aws.String(request.Code),
+	}
+	if request.DeviceName != "" {
+		verifyRequest.FriendlyDeviceName = aws.String(request.DeviceName)
+	}
+
+	log.Infow("Cognito VerifySoftwareToken Request", "DeviceName", request.DeviceName)
+
+	verifyResponse, err := svc.VerifySoftwareToken(verifyRequest)
+	if oauth.IsCognitoError(err, cognito.ErrCodeEnableSoftwareTokenMFAException) {
+		return nil, oauth.ErrBadCode
+	}
+	if err != nil {
+		log.Errorw("Cognito VerifySoftwareToken Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	if aws.StringValue(verifyResponse.Status) != cognito.VerifySoftwareTokenResponseTypeSuccess {
+		return nil, oauth.ErrBadCode
+	}
+
+	// A verified app becomes the way the user signs in from now on
+	preferenceRequest := &cognito.SetUserMFAPreferenceInput{
+		AccessToken: aws.String(accessToken),
+		SoftwareTokenMfaSettings: &cognito.SoftwareTokenMfaSettingsType{
+			Enabled:      aws.Bool(true),
+			PreferredMfa: aws.Bool(true),
+		},
+	}
+
+	log.Infow("Cognito SetUserMFAPreference Request", "Method", "SOFTWARE_TOKEN_MFA")
+
+	_, err = svc.SetUserMFAPreference(preferenceRequest)
+	if err != nil {
+		log.Errorw("Cognito SetUserMFAPreference Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("software token MFA enabled")
+
+	return &MfaVerifyResponse{Status: "enabled"}, nil
+}
+
+func main() {
+	lambda.Start(MfaVerify)
+}
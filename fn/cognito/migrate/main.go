@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/go-github/v28/github"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"strings"
+)
+
+// Cognito reports any error from this trigger as the user not existing, so
+// these only show up in our logs
+var (
+	errUnknownUser = errors.New("no legacy user with this login")
+	errBadPassword = errors.New("github rejected the credentials")
+	errNoEmail     = errors.New("legacy user has no verified email")
+	errUnsupported = errors.New("unsupported trigger source")
+)
+
+// legacyLoginIndex is the global secondary index of the sessions table on
+// the GitHub login.
+const legacyLoginIndex = "GitHubIndex"
+
+// LegacySession is an item of the sessions table written by the GitHub login.
+type LegacySession struct {
+	SessionId string `json:"session_id"`
+	Login     string `json:"github"`
+	AuthToken string `json:"auth_token"`
+}
+
+// findLegacySessions returns every session stored for the GitHub login.
+func findLegacySessions(login string) ([]LegacySession, error) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	db := dynamodb.New(sess)
+
+	sessions := []LegacySession{}
+	var err error
+	queryErr := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("sessions"),
+		IndexName:              aws.String(legacyLoginIndex),
+		KeyConditionExpression: aws.String("github = :login"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":login": {S: aws.String(login)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items := []LegacySession{}
+		if err = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return false
+		}
+		sessions = append(sessions, items...)
+		return true
+	})
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	return sessions, err
+}
+
+// githubUser fetches the user and their primary verified email with client.
+func githubUser(ctx context.Context, client *github.Client) (user *github.User, email string, err error) {
+	user, _, err = client.Users.Get(ctx, "")
+	if err != nil {
+		return
+	}
+
+	emails, _, err := client.Users.ListEmails(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	for _, e := range emails {
+		if e.GetPrimary() && e.GetVerified() {
+			email = e.GetEmail()
+			return
+		}
+	}
+
+	err = errNoEmail
+	return
+}
+
+// storedUser tries the OAuth tokens of the legacy sessions until one of them
+// still works.
+func storedUser(ctx context.Context, sessions []LegacySession) (user *github.User, email string, err error) {
+	err = errUnknownUser
+	for _, s := range sessions {
+		tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: s.AuthToken})
+		user, email, err = githubUser(ctx, github.NewClient(oauth2.NewClient(ctx, tokenSource)))
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// authenticate checks the password against GitHub. Since GitHub no longer
+// takes account passwords over the API, this is a personal access token.
+func authenticate(ctx context.Context, login, password string) (user *github.User, email string, err error) {
+	transport := &github.BasicAuthTransport{
+		Username: login,
+		Password: password,
+	}
+
+	user, email, err = githubUser(ctx, github.NewClient(transport.Client()))
+	if err != nil {
+		if _, ok := err.(*github.ErrorResponse); ok {
+			err = errBadPassword
+		}
+		return
+	}
+
+	if !strings.EqualFold(user.GetLogin(), login) {
+		err = errBadPassword
+	}
+	return
+}
+
+func userAttributes(user *github.User, email string) map[string]string {
+	attributes := map[string]string{
+		"email":              email,
+		"email_verified":     "true",
+		"preferred_username": user.GetLogin(),
+	}
+	if name := user.GetName(); name != "" {
+		attributes["name"] = name
+	}
+	return attributes
+}
+
+func MigrateUser(ctx context.Context, event events.CognitoEventUserPoolsMigrateUser) (events.CognitoEventUserPoolsMigrateUser, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("MigrateUser()")
+
+	sessions, err := findLegacySessions(event.UserName)
+	if err != nil {
+		log.Errorw("DynamoDB Query Error", "Error", err)
+		return event, err
+	}
+
+	if len(sessions) == 0 {
+		log.Infow("legacy user not found")
+		return event, errUnknownUser
+	}
+
+	var user *github.User
+	email := ""
+
+	switch event.TriggerSource {
+	case "UserMigration_Authentication":
+		user, email, err = authenticate(ctx, event.UserName, event.Password)
+	case "UserMigration_ForgotPassword":
+		// There is no password to check, Cognito sends a reset code to the
+		// email GitHub has verified instead
+		user, email, err = storedUser(ctx, sessions)
+	default:
+		err = errUnsupported
+	}
+
+	if err != nil {
+		log.Errorw("legacy user not migrated", "Error", err)
+		return event, err
+	}
+
+	// Cognito only gives the user a sub once this trigger returns, so the
+	// profile waits under the username until the first token is issued
+	profile := users.NewUser("", event.UserName, email)
+	profile.GitHub = user.GetLogin()
+	if _, err = profile.CreatePendingUser(); err != nil {
+		log.Errorw("unable to create user profile", "Error", err)
+		return event, err
+	}
+
+	event.UserAttributes = userAttributes(user, email)
+	event.FinalUserStatus = "CONFIRMED"
+	event.MessageAction = "SUPPRESS"
+
+	log.Infow("legacy user migrated", "Login", user.GetLogin(), "Email", email)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(MigrateUser)
+}
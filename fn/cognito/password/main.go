@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/satori/go.uuid"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// challengeValidity matches how long Cognito keeps the session of a
+// password sign in waiting for a challenge answer.
+const challengeValidity = 3 * time.Minute
+
+// PasswordRequest starts a sign in with Username and Password, or answers
+// the challenge ChallengeId with NewPassword (and any required Attributes)
+// or an MFA Code.
+type PasswordRequest struct {
+	oauth.ClientContext
+	Username    string            `json:"username"`
+	Password    string            `json:"password"`
+	ChallengeId string            `json:"challenge_id"`
+	NewPassword string            `json:"new_password"`
+	Attributes  map[string]string `json:"attributes"`
+	Code        string            `json:"code"`
+}
+
+// PasswordResponse carries either the tokens or the challenge the user has
+// to answer next.
+type PasswordResponse struct {
+	*oauth.TokenResponse
+	Challenge          string   `json:"challenge,omitempty"`
+	ChallengeId        string   `json:"challenge_id,omitempty"`
+	RequiredAttributes []string `json:"required_attributes,omitempty"`
+	Destination        string   `json:"destination,omitempty"`
+}
+
+var supportedChallenges = map[string]bool{
+	cognito.ChallengeNameTypeNewPasswordRequired: true,
+	cognito.ChallengeNameTypeSoftwareTokenMfa:    true,
+	cognito.ChallengeNameTypeSmsMfa:              true,
+}
+
+var (
+	errInvalidSession  = util.NewError("the sign in has expired, please start again", 401)
+	errBadCode         = util.NewError("the code is incorrect, please start again", 401)
+	errMissingResponse = util.NewError("the challenge answer is missing", 400)
+)
+
+// authError maps Cognito errors like everywhere else, except that a wrong
+// MFA code ends the sign in.
+func authError(err error) error {
+	if oauth.IsCognitoError(err, cognito.ErrCodeCodeMismatchException) || oauth.IsCognitoError(err, cognito.ErrCodeExpiredCodeException) {
+		return errBadCode
+	}
+	return oauth.CognitoError(err)
+}
+
+// requiredAttributes lists the attributes a NEW_PASSWORD_REQUIRED challenge
+// wants set, which Cognito sends as a JSON array of "userAttributes.<name>".
+func requiredAttributes(param string) []string {
+	names := []string{}
+	if param == "" || json.Unmarshal([]byte(param), &names) != nil {
+		return nil
+	}
+
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, "userAttributes.")
+	}
+
+	return names
+}
+
+// next saves the session of a challenge and tells the user to answer it,
+// or saves the session of a finished sign in.
+func next(log *zap.SugaredLogger, client oauth.ClientContext, challenge oauth.Challenge, name, session *string, params map[string]*string, result *cognito.AuthenticationResultType) (*PasswordResponse, error) {
+	if result != nil {
+		if challenge.ChallengeId != "" {
+			if err := oauth.DeleteChallenge(challenge.ChallengeId); err != nil {
+				log.Errorw("unable to delete challenge", "Error", err)
+			}
+		}
+
+		ciSession := oauth.NewCognitoSession(challenge.Username, oauth.ProviderPassword, client, result)
+		credential, err := ciSession.IssueSession()
+		if err != nil {
+			return nil, err
+		}
+
+		log.Infow("password sign in completed", "User", challenge.Username)
+
+		return &PasswordResponse{TokenResponse: ciSession.TokenResponse(credential)}, nil
+	}
+
+	challengeName := aws.StringValue(name)
+	if !supportedChallenges[challengeName] {
+		log.Errorw("unsupported challenge", "ChallengeName", challengeName)
+		return nil, util.NewError("this account needs a sign in method the API doesn't support", 403)
+	}
+
+	challenge.Parameters = aws.StringValueMap(params)
+	if username := challenge.Parameters["USER_ID_FOR_SRP"]; username != "" {
+		challenge.Username = username
+	}
+	if challenge.ChallengeId == "" {
+		challenge.ChallengeId = uuid.NewV4().String()
+	}
+	challenge.ChallengeName = challengeName
+	challenge.Session = aws.StringValue(session)
+	challenge.ExpiresAt = time.Now().Add(challengeValidity).Unix()
+
+	if err := challenge.SaveChallenge(); err != nil {
+		log.Errorw("unable to save challenge", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("password sign in challenged", "ChallengeName", challengeName, "ChallengeId", challenge.ChallengeId)
+
+	response := &PasswordResponse{
+		Challenge:          challengeName,
+		ChallengeId:        challenge.ChallengeId,
+		Destination:        challenge.Parameters["CODE_DELIVERY_DESTINATION"],
+		RequiredAttributes: requiredAttributes(challenge.Parameters["requiredAttributes"]),
+	}
+
+	return response, nil
+}
+
+func start(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, clientId string, request *PasswordRequest) (*PasswordResponse, error) {
+	initiateAuthRequest := &cognito.InitiateAuthInput{
+		AuthFlow: aws.String(cognito.AuthFlowTypeUserPasswordAuth),
+		ClientId: aws.String(clientId),
+		AuthParameters: map[string]*string{
+			"USERNAME": aws.String(request.Username),
+			"PASSWORD": aws.String(request.Password),
+		},
+	}
+
+	log.Infow("Cognito InitiateAuth Request", "Username", request.Username)
+
+	initiateAuthResponse, err := svc.InitiateAuth(initiateAuthRequest)
+	if err != nil {
+		log.Errorw("Cognito InitiateAuth Error", "Error", err)
+		return nil, authError(err)
+	}
+
+	log.Infow("Cognito InitiateAuth Response", "ChallengeName", initiateAuthResponse.ChallengeName)
+
+	challenge := oauth.Challenge{Username: request.Username}
+
+	return next(log, request.ClientContext, challenge, initiateAuthResponse.ChallengeName, initiateAuthResponse.Session,
+		initiateAuthResponse.ChallengeParameters, initiateAuthResponse.AuthenticationResult)
+}
+
+func respond(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, clientId string, request *PasswordRequest) (*PasswordResponse, error) {
+	challenge, err := oauth.GetChallenge(request.ChallengeId)
+	if err == oauth.ErrChallengeNotFound {
+		return nil, errInvalidSession
+	}
+	if err != nil {
+		log.Errorw("unable to read challenge", "Error", err)
+		return nil, err
+	}
+
+	responses := map[string]*string{
+		"USERNAME": aws.String(challenge.Username),
+	}
+
+	switch challenge.ChallengeName {
+	case cognito.ChallengeNameTypeNewPasswordRequired:
+		if request.NewPassword == "" {
+			return nil, errMissingResponse
+		}
+		responses["NEW_PASSWORD"] = aws.String(request.NewPassword)
+		for name, value := range request.Attributes {
+			responses["userAttributes."+name] = aws.String(value)
+		}
+	case cognito.ChallengeNameTypeSoftwareTokenMfa:
+		if request.Code == "" {
+			return nil, errMissingResponse
+		}
+		responses["SOFTWARE_TOKEN_MFA_CODE"] = aws.String(request.Code)
+	case cognito.ChallengeNameTypeSmsMfa:
+		if request.Code == "" {
+			return nil, errMissingResponse
+		}
+		responses["SMS_MFA_CODE"] = aws.String(request.Code)
+	default:
+		// The challenges table is shared with other sign in methods, whose
+		// challenges can't be answered here
+		log.Errorw("unsupported challenge", "ChallengeName", challenge.ChallengeName, "ChallengeId", challenge.ChallengeId)
+		return nil, errInvalidSession
+	}
+
+	respondRequest := &cognito.RespondToAuthChallengeInput{
+		ChallengeName:      aws.String(challenge.ChallengeName),
+		ClientId:           aws.String(clientId),
+		Session:            aws.String(challenge.Session),
+		ChallengeResponses: responses,
+	}
+
+	log.Infow("Cognito RespondToAuthChallenge Request", "ChallengeName", challenge.ChallengeName, "ChallengeId", challenge.ChallengeId)
+
+	respondResponse, err := svc.RespondToAuthChallenge(respondRequest)
+	if err != nil {
+		log.Errorw("Cognito RespondToAuthChallenge Error", "Error", err)
+		err = authError(err)
+		// Cognito ends the sign in on anything but a password the policy
+		// rejects, so the session can't be answered again
+		if lerr, ok := err.(*util.LambdaError); !ok || lerr.Status != 400 {
+			oauth.DeleteChallenge(challenge.ChallengeId)
+		}
+		return nil, err
+	}
+
+	log.Infow("Cognito RespondToAuthChallenge Response", "ChallengeName", respondResponse.ChallengeName)
+
+	return next(log, request.ClientContext, *challenge, respondResponse.ChallengeName, respondResponse.Session,
+		respondResponse.ChallengeParameters, respondResponse.AuthenticationResult)
+}
+
+func Password(ctx context.Context, request *PasswordRequest) (*PasswordResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	// The request holds passwords, only log what identifies it
+	log.Infow("Password()", "Username", request.Username, "ChallengeId", request.ChallengeId)
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := oauth.NewCognitoClient()
+
+	switch {
+	case request.ChallengeId != "":
+		return respond(log, svc, *info.ClientID, request)
+	case request.Username != "" && request.Password != "":
+		return start(log, svc, *info.ClientID, request)
+	default:
+		return nil, util.NewError("either username and password, or challenge_id are required", 400)
+	}
+}
+
+func main() {
+	lambda.Start(Password)
+}
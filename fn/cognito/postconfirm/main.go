@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func PostConfirmation(ctx context.Context, event events.CognitoEventUserPoolsPostConfirmation) (events.CognitoEventUserPoolsPostConfirmation, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("PostConfirmation()")
+
+	// Confirming a password reset fires this trigger too, the profile only
+	// needs creating on sign up
+	if event.TriggerSource != "PostConfirmation_ConfirmSignUp" {
+		return event, nil
+	}
+
+	attributes := event.Request.UserAttributes
+
+	user := users.NewUser(attributes["sub"], event.UserName, attributes["email"])
+	if locale := attributes["locale"]; locale != "" {
+		user.Preferences["locale"] = locale
+	}
+
+	// Cognito retries the trigger on timeouts, so an existing profile is fine
+	created, err := user.CreateUser()
+	if err != nil {
+		log.Errorw("unable to create user profile", "Sub", user.Sub, "Error", err)
+		return event, err
+	}
+
+	log.Infow("user profile provisioned", "Sub", user.Sub, "Created", created)
+
+	// The pre sign up trigger only checked the invitation, it is used up now
+	// the user exists
+	if code := strings.TrimSpace(attributes["custom:invitation_code"]); code != "" {
+		email := strings.ToLower(strings.TrimSpace(attributes["email"]))
+		err = users.RedeemInvitation(code, email, event.UserName)
+		switch {
+		case err == users.ErrInvalidInvitation:
+			// Another sign up redeemed it between the two triggers
+			log.Warnw("invitation already redeemed", "Sub", user.Sub)
+		case err != nil:
+			log.Errorw("unable to redeem invitation", "Sub", user.Sub, "Error", err)
+			return event, err
+		default:
+			log.Infow("invitation redeemed", "Sub", user.Sub)
+		}
+	}
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(PostConfirmation)
+}
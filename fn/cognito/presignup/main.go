@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// The hosted UI shows these to the user as "PreSignUp failed with error <message>"
+var (
+	errNotAllowed        = errors.New("Sign up is by invitation only. Please ask your AWSci administrator for an invitation.")
+	errInvalidInvitation = errors.New("This invitation code is invalid, has expired or has already been used. Please ask for a new invitation.")
+)
+
+// invitationCode returns the code passed either as validation data through
+// the SignUp API or as a custom attribute from the hosted UI.
+func invitationCode(event *events.CognitoEventUserPoolsPreSignup) string {
+	if code := event.Request.ValidationData["invitation_code"]; code != "" {
+		return strings.TrimSpace(code)
+	}
+	return strings.TrimSpace(event.Request.UserAttributes["custom:invitation_code"])
+}
+
+func domainAllowed(email string, allowed []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := email[at+1:]
+	for _, a := range allowed {
+		if domain == a {
+			return true
+		}
+	}
+
+	return false
+}
+
+func PreSignUp(ctx context.Context, event events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("PreSignUp()")
+
+	// Users created by an administrator are invited by definition
+	if event.TriggerSource == "PreSignUp_AdminCreateUser" {
+		return event, nil
+	}
+
+	email := strings.ToLower(strings.TrimSpace(event.Request.UserAttributes["email"]))
+
+	if code := invitationCode(&event); code != "" {
+		invitation, err := users.GetInvitation(code, email)
+		if err != nil {
+			log.Errorw("invitation rejected", "Email", email, "Error", err)
+			if err != users.ErrInvalidInvitation {
+				return event, errors.New("We couldn't check your invitation right now. Please try again later.")
+			}
+			return event, errInvalidInvitation
+		}
+
+		// The invitation is redeemed by the post confirmation trigger, once
+		// the user actually exists
+		log.Infow("invitation accepted", "Email", email, "Open", invitation.Email == "")
+
+		event.Response.AutoConfirmUser = true
+
+		// Only an invitation sent to this very address shows the user owns it,
+		// open invitations leave the email to be verified as usual
+		event.Response.AutoVerifyEmail = invitation.Email == email
+
+		return event, nil
+	}
+
+	config, err := ssm.GetSignUpConfig()
+	if err != nil {
+		return event, errors.New("Sign up is unavailable right now. Please try again later.")
+	}
+
+	if !domainAllowed(email, config.AllowedDomains) {
+		log.Infow("sign up rejected", "Email", email)
+		return event, errNotAllowed
+	}
+
+	log.Infow("sign up allowed", "Email", email)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(PreSignUp)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// suppressedClaims are standard claims our API doesn't use, dropped to keep
+// the ID token small and free of personal data we don't need to hand out.
+var suppressedClaims = []string{
+	"address",
+	"birthdate",
+	"gender",
+	"locale",
+	"phone_number",
+	"phone_number_verified",
+	"zoneinfo",
+}
+
+// getUser and claimPendingUser read the profile of a user, replaced by the
+// tests.
+var (
+	getUser          = users.GetUser
+	claimPendingUser = users.ClaimPendingUser
+)
+
+// roles merges the user's groups with the roles on their profile.
+func roles(groups []string, profile *users.User) []string {
+	set := map[string]bool{users.DefaultRole: true}
+	for _, group := range groups {
+		set[group] = true
+	}
+	if profile != nil {
+		for _, role := range profile.Roles {
+			set[role] = true
+		}
+	}
+
+	roles := []string{}
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+func PreTokenGen(ctx context.Context, event events.CognitoEventUserPoolsPreTokenGen) (events.CognitoEventUserPoolsPreTokenGen, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("PreTokenGen()", "Groups", event.Request.GroupConfiguration.GroupsToOverride)
+
+	sub := event.Request.UserAttributes["sub"]
+
+	// A missing profile only costs the user the extra claims, it shouldn't
+	// stop them from signing in
+	profile, err := getUser(sub)
+	if err == users.ErrNotFound {
+		// Migrated users get their profile on the first token
+		profile, err = claimPendingUser(sub, event.UserName)
+	}
+	if err != nil && err != users.ErrNotFound {
+		log.Errorw("unable to read user profile", "Sub", sub, "Error", err)
+	}
+
+	claims := map[string]string{
+		"roles": strings.Join(roles(event.Request.GroupConfiguration.GroupsToOverride, profile), ","),
+	}
+
+	if profile != nil {
+		if profile.Tenant != "" {
+			claims["tenant"] = profile.Tenant
+		}
+		if profile.GitHub != "" {
+			claims["github_login"] = profile.GitHub
+		}
+	}
+
+	event.Response.ClaimsOverrideDetails = events.ClaimsOverrideDetails{
+		ClaimsToAddOrOverride: claims,
+		ClaimsToSuppress:      suppressedClaims,
+	}
+
+	log.Infow("token claims customized", "Claims", claims, "Suppressed", suppressedClaims)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(PreTokenGen)
+}
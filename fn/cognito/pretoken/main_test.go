@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixture is a PreTokenGeneration event recorded from the user pool, along
+// with the profile the users table held for it and the claims we expect.
+// PendingProfile is a profile left by the migration trigger.
+type fixture struct {
+	Event          events.CognitoEventUserPoolsPreTokenGen `json:"Event"`
+	Profile        *users.User                             `json:"Profile"`
+	PendingProfile *users.User                             `json:"PendingProfile"`
+	ProfileError   string                                  `json:"ProfileError"`
+	ExpectedClaims map[string]string                       `json:"ExpectedClaims"`
+}
+
+func TestPreTokenGen(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures found in testdata")
+	}
+
+	defer func(get func(string) (*users.User, error), claim func(string, string) (*users.User, error)) {
+		getUser, claimPendingUser = get, claim
+	}(getUser, claimPendingUser)
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fx := fixture{}
+			if err = json.Unmarshal(data, &fx); err != nil {
+				t.Fatal(err)
+			}
+
+			getUser = func(sub string) (*users.User, error) {
+				if want := fx.Event.Request.UserAttributes["sub"]; sub != want {
+					t.Errorf("profile looked up for %q, want %q", sub, want)
+				}
+				switch {
+				case fx.ProfileError != "":
+					return nil, errors.New(fx.ProfileError)
+				case fx.Profile == nil:
+					return nil, users.ErrNotFound
+				}
+				return fx.Profile, nil
+			}
+			claimPendingUser = func(sub, username string) (*users.User, error) {
+				if username != fx.Event.UserName {
+					t.Errorf("pending profile claimed for %q, want %q", username, fx.Event.UserName)
+				}
+				if fx.PendingProfile == nil {
+					return nil, users.ErrNotFound
+				}
+				fx.PendingProfile.Sub = sub
+				return fx.PendingProfile, nil
+			}
+
+			response, err := PreTokenGen(context.Background(), fx.Event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			details := response.Response.ClaimsOverrideDetails
+			if !reflect.DeepEqual(details.ClaimsToAddOrOverride, fx.ExpectedClaims) {
+				t.Errorf("unexpected claims:\n  got:  %v\n  want: %v", details.ClaimsToAddOrOverride, fx.ExpectedClaims)
+			}
+			if !reflect.DeepEqual(details.ClaimsToSuppress, suppressedClaims) {
+				t.Errorf("unexpected suppressed claims:\n  got:  %v\n  want: %v", details.ClaimsToSuppress, suppressedClaims)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/users"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// maxAttributeLength is Cognito's limit for string attributes.
+const maxAttributeLength = 2048
+
+// mutableAttributes are the attributes users may change themselves. The app
+// clients don't restrict writes, so custom:* attributes have to be listed by
+// name, custom:invitation_code for one is only ever set at sign up.
+var mutableAttributes = map[string]bool{
+	"name":               true,
+	"given_name":         true,
+	"family_name":        true,
+	"middle_name":        true,
+	"nickname":           true,
+	"preferred_username": true,
+	"profile":            true,
+	"picture":            true,
+	"website":            true,
+	"email":              true,
+	"gender":             true,
+	"birthdate":          true,
+	"zoneinfo":           true,
+	"locale":             true,
+	"phone_number":       true,
+	"address":            true,
+}
+
+// ProfileRequest either updates Attributes, or verifies the changed
+// VerifyAttribute (email unless given) with the Code sent to the user.
+type ProfileRequest struct {
+	oauth.ClientContext
+	AccessToken     *string           `json:"access_token"`
+	Attributes      map[string]string `json:"attributes"`
+	VerifyAttribute string            `json:"verify_attribute"`
+	Code            string            `json:"code"`
+}
+
+type ProfileResponse struct {
+	Status               string   `json:"status"`
+	VerificationRequired []string `json:"verification_required,omitempty"`
+	Destination          string   `json:"destination,omitempty"`
+}
+
+func validateAttributes(attributes map[string]string) ([]*cognito.AttributeType, error) {
+	if len(attributes) == 0 {
+		return nil, util.NewError("attributes are required", 400)
+	}
+
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	updates := []*cognito.AttributeType{}
+	for _, name := range names {
+		value := strings.TrimSpace(attributes[name])
+
+		if !mutableAttributes[name] {
+			return nil, util.NewError(name+" can't be changed", 400)
+		}
+		if len(value) > maxAttributeLength {
+			return nil, util.NewError(name+" is too long", 400)
+		}
+		if name == "email" {
+			value = util.NormalizeEmail(value)
+			if err := util.ValidateEmail(value); err != nil {
+				return nil, err
+			}
+		}
+
+		updates = append(updates, &cognito.AttributeType{Name: aws.String(name), Value: aws.String(value)})
+	}
+
+	return updates, nil
+}
+
+// attributeNames lists the names of attributes, for logging without values.
+func attributeNames(attributes []*cognito.AttributeType) []string {
+	names := []string{}
+	for _, attribute := range attributes {
+		names = append(names, aws.StringValue(attribute.Name))
+	}
+	return names
+}
+
+func update(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, accessToken string, attributes map[string]string) (*ProfileResponse, error) {
+	updates, err := validateAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	updateRequest := &cognito.UpdateUserAttributesInput{
+		AccessToken:    aws.String(accessToken),
+		UserAttributes: updates,
+	}
+
+	log.Infow("Cognito UpdateUserAttributes Request", "Attributes", attributeNames(updates))
+
+	updateResponse, err := svc.UpdateUserAttributes(updateRequest)
+	if err != nil {
+		log.Errorw("Cognito UpdateUserAttributes Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("Cognito UpdateUserAttributes Response", "CodeDeliveryDetails", updateResponse.CodeDeliveryDetailsList)
+
+	// A changed email or phone number is unverified until the user enters
+	// the code Cognito just sent to it
+	response := &ProfileResponse{Status: "updated"}
+	for _, delivery := range updateResponse.CodeDeliveryDetailsList {
+		response.VerificationRequired = append(response.VerificationRequired, aws.StringValue(delivery.AttributeName))
+		response.Destination = aws.StringValue(delivery.Destination)
+	}
+
+	return response, nil
+}
+
+func verify(log *zap.SugaredLogger, svc *cognito.CognitoIdentityProvider, accessToken, attribute, code string) (*ProfileResponse, error) {
+	if attribute == "" {
+		attribute = "email"
+	}
+	if attribute != "email" && attribute != "phone_number" {
+		return nil, util.NewError("verify_attribute must be email or phone_number", 400)
+	}
+	if err := util.ValidateCode(code); err != nil {
+		return nil, err
+	}
+
+	log.Infow("Cognito VerifyUserAttribute Request", "Attribute", attribute)
+
+	_, err := svc.VerifyUserAttribute(&cognito.VerifyUserAttributeInput{
+		AccessToken:   aws.String(accessToken),
+		AttributeName: aws.String(attribute),
+		Code:          aws.String(code),
+	})
+	if err != nil {
+		log.Errorw("Cognito VerifyUserAttribute Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	if attribute == "email" {
+		user, err := svc.GetUser(&cognito.GetUserInput{AccessToken: aws.String(accessToken)})
+		if err != nil {
+			log.Errorw("Cognito GetUser Error", "Error", err)
+			return nil, oauth.CognitoError(err)
+		}
+
+		values := map[string]string{}
+		for _, a := range user.UserAttributes {
+			values[aws.StringValue(a.Name)] = aws.StringValue(a.Value)
+		}
+
+		if err = users.UpdateEmail(values["sub"], values["email"]); err != nil {
+			log.Errorw("unable to update user profile email", "Sub", values["sub"], "Error", err)
+			return nil, err
+		}
+	}
+
+	log.Infow("attribute verified", "Attribute", attribute)
+
+	return &ProfileResponse{Status: "verified"}, nil
+}
+
+func Profile(ctx context.Context, request ProfileRequest) (*ProfileResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	// Attribute values are personal data, only log which were sent
+	names := []string{}
+	for name := range request.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	log.Infow("Profile()", "Attributes", names, "VerifyAttribute", request.VerifyAttribute)
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	accessToken, err := cognitoSession.CurrentAccessToken(ctx)
+	if err != nil {
+		log.Errorw("unable to obtain access token", "Error", err)
+		return nil, err
+	}
+
+	svc := oauth.NewCognitoClient()
+
+	if request.Code != "" {
+		return verify(log, svc, accessToken, request.VerifyAttribute, request.Code)
+	}
+
+	return update(log, svc, accessToken, request.Attributes)
+}
+
+func main() {
+	lambda.Start(Profile)
+}
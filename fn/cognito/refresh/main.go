@@ -4,15 +4,25 @@ import (
 	"context"
 	"github.com/aws/aws-lambda-go/lambda"
 	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
 	"go.uber.org/zap"
 )
 
+// RefreshRequest trades a refresh credential for a new access token and
+// credential, either as JSON or as the form Body of an RFC 6749 section 6
+// refresh_token grant. Clients without a credential yet can still present
+// their access token once to be issued one.
 type RefreshRequest struct {
-	AccessToken string `json:"access_token"`
+	oauth.ClientContext
+	GrantType         string `json:"grant_type"`
+	RefreshToken      string `json:"refresh_token"`
+	RefreshCredential string `json:"refresh_credential"`
+	AccessToken       string `json:"access_token"`
+	Body              string `json:"body"`
 }
 
 type RefreshResponse struct {
-	AccessToken string `json:"access_token"`
+	*oauth.TokenResponse
 }
 
 func Refresh(ctx context.Context, request *RefreshRequest) (*RefreshResponse, error) {
@@ -22,22 +32,71 @@ func Refresh(ctx context.Context, request *RefreshRequest) (*RefreshResponse, er
 	defer logger.Sync()
 	log := logger.Sugar()
 
-	log.Infow("Refresh Request", "Request", request)
+	log.Infow("Refresh Request", "UserAgent", request.UserAgent, "SourceIP", request.SourceIP)
 
-	tokenSource, err := oauth.GetOauthTokenSource(ctx, request.AccessToken)
-	if err != nil {
-		log.Errorw("unable to obtain a TokenSource", "Error", err)
+	var cognitoSession *oauth.CognitoSession
+	credential := ""
+	var err error
+
+	if request.Body != "" {
+		request.GrantType = oauth.GrantTypeRefreshToken
+		request.RefreshToken, err = oauth.ParseRefreshForm(request.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if request.GrantType != "" && request.GrantType != oauth.GrantTypeRefreshToken {
+		return nil, oauth.ErrUnsupportedGrantType
+	}
+	if request.RefreshToken != "" {
+		request.RefreshCredential = request.RefreshToken
+	}
+
+	switch {
+	case request.RefreshCredential != "":
+		cognitoSession, err = oauth.CheckRefreshCredential(ctx, request.RefreshCredential, request.ClientContext)
+		if err != nil {
+			log.Errorw("unable to check refresh credential", "Error", err)
+			return nil, err
+		}
+	case request.AccessToken != "":
+		cognitoSession, err = oauth.GetSession(request.AccessToken)
+		if err != nil {
+			log.Errorw("unable to find session", "Error", err)
+			return nil, err
+		}
+		// Only once, or a leaked access token could start new families
+		if cognitoSession.RefreshCredentialIssued {
+			return nil, oauth.ErrRefreshCredentialIssued
+		}
+	default:
+		return nil, util.NewError("refresh_credential is required", 400)
+	}
+
+	// The credential is only used up once Cognito has refreshed the session,
+	// so a failed refresh leaves the client with a credential that still works
+	if _, err = cognitoSession.Refresh(ctx); err != nil {
+		log.Errorw("unable to obtain a Token", "Error", err)
 		return nil, err
 	}
 
-	token, err := tokenSource.Token()
+	if request.RefreshCredential != "" {
+		credential, err = oauth.RotateRefreshCredential(ctx, request.RefreshCredential, cognitoSession, request.ClientContext)
+	} else {
+		credential, err = cognitoSession.StartRefreshFamily()
+	}
 	if err != nil {
-		log.Errorw("unable to obtain a Token", "Error", err)
+		log.Errorw("unable to issue refresh credential", "Error", err)
 		return nil, err
 	}
-	return &RefreshResponse{AccessToken: token.AccessToken}, nil
+
+	log.Infow("session refreshed", "SessionId", cognitoSession.SessionId)
+
+	return &RefreshResponse{
+		TokenResponse: cognitoSession.TokenResponse(credential),
+	}, nil
 }
 
 func main() {
 	lambda.Start(Refresh)
-}
\ No newline at end of file
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+)
+
+type ResendCodeRequest struct {
+	Email string `json:"email"`
+}
+
+type ResendCodeResponse struct {
+	Status string `json:"status"`
+}
+
+func ResendCode(ctx context.Context, request *ResendCodeRequest) (*ResendCodeResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	email := util.NormalizeEmail(request.Email)
+
+	log.Infow("ResendCode()", "Email", email)
+
+	if err := util.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	resendRequest := &cognito.ResendConfirmationCodeInput{
+		ClientId: aws.String(*info.ClientID),
+		Username: aws.String(email),
+	}
+
+	log.Infow("Cognito ResendConfirmationCode Request", "Email", email)
+
+	sent := &ResendCodeResponse{Status: "sent"}
+
+	_, err = oauth.NewCognitoClient().ResendConfirmationCode(resendRequest)
+	// Unknown and already confirmed users get the same answer as everyone else
+	if oauth.IsCognitoError(err, cognito.ErrCodeUserNotFoundException) || oauth.IsCognitoError(err, cognito.ErrCodeInvalidParameterException) {
+		log.Infow("confirmation code not resent", "Email", email, "Error", err)
+		return sent, nil
+	}
+	if err != nil {
+		log.Errorw("Cognito ResendConfirmationCode Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("confirmation code resent", "Email", email)
+
+	return sent, nil
+}
+
+func main() {
+	lambda.Start(ResendCode)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// RevokeSessionRequest signs out the session SessionId, or with All every
+// session of the user including the one making the request.
+type RevokeSessionRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+	SessionId   string  `json:"session_id"`
+	All         bool    `json:"all"`
+}
+
+type RevokeSessionResponse struct {
+	Revoked []string `json:"revoked"`
+}
+
+func RevokeSession(ctx context.Context, request RevokeSessionRequest) (*RevokeSessionResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("RevokeSession()", "SessionId", request.SessionId, "All", request.All)
+
+	if request.SessionId == "" && !request.All {
+		return nil, util.NewError("either session_id or all is required", 400)
+	}
+
+	current, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, true)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	sessions, err := oauth.ListSessions(current.User)
+	if err != nil {
+		log.Errorw("unable to list sessions", "User", current.User, "Error", err)
+		return nil, err
+	}
+
+	// Only the user's own sessions can be found here, so nobody can sign
+	// out someone else by guessing a session id
+	targets := []oauth.CognitoSession{}
+	for _, s := range sessions {
+		if request.All || s.SessionId == request.SessionId {
+			targets = append(targets, s)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, util.NewError("session not found", 404)
+	}
+
+	response := &RevokeSessionResponse{Revoked: []string{}}
+
+	var errs error
+	for _, s := range targets {
+		if err := s.Revoke(ctx); err != nil {
+			log.Errorw("unable to revoke session", "SessionId", s.SessionId, "Error", err)
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		response.Revoked = append(response.Revoked, s.SessionId)
+	}
+
+	log.Infow("sessions revoked", "User", current.User, "Revoked", response.Revoked)
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	return response, nil
+}
+
+func main() {
+	lambda.Start(RevokeSession)
+}
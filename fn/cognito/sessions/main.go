@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+type SessionsRequest struct {
+	oauth.ClientContext
+	AccessToken *string `json:"access_token"`
+}
+
+// Session describes a session without any of its tokens.
+type Session struct {
+	SessionId string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	Current   bool      `json:"current"`
+}
+
+type SessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+func Sessions(ctx context.Context, request SessionsRequest) (*SessionsResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	log.Infow("Sessions()")
+
+	current, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, false)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
+
+	sessions, err := oauth.ListSessions(current.User)
+	if err != nil {
+		log.Errorw("unable to list sessions", "User", current.User, "Error", err)
+		return nil, err
+	}
+
+	response := &SessionsResponse{Sessions: []Session{}}
+	for _, s := range sessions {
+		response.Sessions = append(response.Sessions, Session{
+			SessionId: s.SessionId,
+			CreatedAt: s.CreatedAt,
+			LastUsed:  s.LastUsed,
+			UserAgent: s.UserAgent,
+			SourceIP:  s.SourceIP,
+			Provider:  s.Provider,
+			Current:   s.SessionId == current.SessionId,
+		})
+	}
+
+	// Most recently used first
+	sort.Slice(response.Sessions, func(i, j int) bool {
+		return response.Sessions[i].LastUsed.After(response.Sessions[j].LastUsed)
+	})
+
+	log.Infow("listed sessions", "User", current.User, "Count", len(response.Sessions))
+
+	return response, nil
+}
+
+func main() {
+	lambda.Start(Sessions)
+}
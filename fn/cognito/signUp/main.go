@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"strings"
+)
+
+type SignUpRequest struct {
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	Name           string `json:"name"`
+	InvitationCode string `json:"invitation_code"`
+}
+
+type SignUpResponse struct {
+	Status string `json:"status"`
+}
+
+const (
+	statusConfirmationSent = "confirmation_sent"
+	statusConfirmed        = "confirmed"
+)
+
+func SignUp(ctx context.Context, request *SignUpRequest) (*SignUpResponse, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	email := util.NormalizeEmail(request.Email)
+
+	log.Infow("SignUp()", "Email", email)
+
+	if err := util.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+	if err := util.ValidatePassword(request.Password, oauth.GetPasswordPolicy()); err != nil {
+		return nil, err
+	}
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	signUpRequest := &cognito.SignUpInput{
+		ClientId: aws.String(*info.ClientID),
+		Username: aws.String(email),
+		Password: aws.String(request.Password),
+		UserAttributes: []*cognito.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(email)},
+		},
+	}
+	if name := strings.TrimSpace(request.Name); name != "" {
+		signUpRequest.UserAttributes = append(signUpRequest.UserAttributes, &cognito.AttributeType{
+			Name: aws.String("name"), Value: aws.String(name),
+		})
+	}
+	if code := strings.TrimSpace(request.InvitationCode); code != "" {
+		// Read by the pre sign up trigger, and kept on the user so the post
+		// confirmation trigger can redeem it
+		signUpRequest.ValidationData = []*cognito.AttributeType{
+			{Name: aws.String("invitation_code"), Value: aws.String(code)},
+		}
+		signUpRequest.UserAttributes = append(signUpRequest.UserAttributes, &cognito.AttributeType{
+			Name: aws.String("custom:invitation_code"), Value: aws.String(code),
+		})
+	}
+
+	log.Infow("Cognito SignUp Request", "Email", email)
+
+	signUpResponse, err := oauth.NewCognitoClient().SignUp(signUpRequest)
+	if oauth.IsCognitoError(err, cognito.ErrCodeUsernameExistsException) {
+		// Answer as if the account was new, so sign up can't be used to
+		// find out who has one
+		log.Infow("sign up for existing user", "Email", email)
+		return &SignUpResponse{Status: statusConfirmationSent}, nil
+	}
+	if err != nil {
+		log.Errorw("Cognito SignUp Error", "Error", err)
+		return nil, oauth.CognitoError(err)
+	}
+
+	log.Infow("Cognito SignUp Response", "UserSub", signUpResponse.UserSub, "UserConfirmed", signUpResponse.UserConfirmed)
+
+	if aws.BoolValue(signUpResponse.UserConfirmed) {
+		return &SignUpResponse{Status: statusConfirmed}, nil
+	}
+
+	return &SignUpResponse{Status: statusConfirmationSent}, nil
+}
+
+func main() {
+	lambda.Start(SignUp)
+}
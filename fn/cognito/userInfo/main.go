@@ -4,24 +4,137 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/fatih/structs"
 	"go.smartmachine.io/awsci-api/pkg/oauth"
+	"go.smartmachine.io/awsci-api/pkg/users"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"io/ioutil"
+	"strconv"
+	"strings"
 )
 
 type UserInfoRequest struct{
+	oauth.ClientContext
 	AccessToken *string `json:"access_token"`
 }
 
+// Address is the OIDC address claim, Cognito only keeps the formatted form.
+type Address struct {
+	Formatted string `json:"formatted"`
+}
+
+// UserInfoResponse holds the standard OIDC claims with their proper types,
+// the user's custom:* attributes and their profile.
 type UserInfoResponse struct {
-	Email         string `json:"email"`
-	EmailVerified string `json:"email_verified"`
-	FamilyName    string `json:"family_name"`
-	Name          string `json:"name"`
-	Sub           string `json:"sub"`
-	Username      string `json:"username"`
+	Sub                 string            `json:"sub"`
+	Username            string            `json:"username"`
+	Name                string            `json:"name,omitempty"`
+	GivenName           string            `json:"given_name,omitempty"`
+	FamilyName          string            `json:"family_name,omitempty"`
+	MiddleName          string            `json:"middle_name,omitempty"`
+	Nickname            string            `json:"nickname,omitempty"`
+	PreferredUsername   string            `json:"preferred_username,omitempty"`
+	Profile             string            `json:"profile,omitempty"`
+	Picture             string            `json:"picture,omitempty"`
+	Website             string            `json:"website,omitempty"`
+	Email               string            `json:"email,omitempty"`
+	EmailVerified       bool              `json:"email_verified"`
+	Gender              string            `json:"gender,omitempty"`
+	Birthdate           string            `json:"birthdate,omitempty"`
+	Zoneinfo            string            `json:"zoneinfo,omitempty"`
+	Locale              string            `json:"locale,omitempty"`
+	PhoneNumber         string            `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool              `json:"phone_number_verified"`
+	Address             *Address          `json:"address,omitempty"`
+	UpdatedAt           int64             `json:"updated_at,omitempty"`
+	CustomAttributes    map[string]string `json:"custom_attributes,omitempty"`
+	Roles               []string          `json:"roles,omitempty"`
+	Tenant              string            `json:"tenant,omitempty"`
+	GitHub              string            `json:"github,omitempty"`
+	Preferences         map[string]string `json:"preferences,omitempty"`
+}
+
+// claimString and its siblings accept claims both in their JSON type and as
+// the strings Cognito returns them as.
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
+
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return false
+}
+
+func claimInt(claims map[string]interface{}, name string) int64 {
+	switch value := claims[name].(type) {
+	case float64:
+		return int64(value)
+	case string:
+		i, _ := strconv.ParseInt(value, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func newUserInfoResponse(claims map[string]interface{}) *UserInfoResponse {
+	response := &UserInfoResponse{
+		Sub:                 claimString(claims, "sub"),
+		Username:            claimString(claims, "username"),
+		Name:                claimString(claims, "name"),
+		GivenName:           claimString(claims, "given_name"),
+		FamilyName:          claimString(claims, "family_name"),
+		MiddleName:          claimString(claims, "middle_name"),
+		Nickname:            claimString(claims, "nickname"),
+		PreferredUsername:   claimString(claims, "preferred_username"),
+		Profile:             claimString(claims, "profile"),
+		Picture:             claimString(claims, "picture"),
+		Website:             claimString(claims, "website"),
+		Email:               claimString(claims, "email"),
+		EmailVerified:       claimBool(claims, "email_verified"),
+		Gender:              claimString(claims, "gender"),
+		Birthdate:           claimString(claims, "birthdate"),
+		Zoneinfo:            claimString(claims, "zoneinfo"),
+		Locale:              claimString(claims, "locale"),
+		PhoneNumber:         claimString(claims, "phone_number"),
+		PhoneNumberVerified: claimBool(claims, "phone_number_verified"),
+		UpdatedAt:           claimInt(claims, "updated_at"),
+	}
+
+	switch address := claims["address"].(type) {
+	case string:
+		if address != "" {
+			response.Address = &Address{Formatted: address}
+		}
+	case map[string]interface{}:
+		response.Address = &Address{Formatted: claimString(address, "formatted")}
+	}
+
+	for name := range claims {
+		if strings.HasPrefix(name, "custom:") {
+			if response.CustomAttributes == nil {
+				response.CustomAttributes = map[string]string{}
+			}
+			response.CustomAttributes[name] = claimString(claims, name)
+		}
+	}
+
+	return response
 }
 
 func UserInfo(ctx context.Context, request UserInfoRequest) (*UserInfoResponse, error) {
@@ -30,9 +143,15 @@ func UserInfo(ctx context.Context, request UserInfoRequest) (*UserInfoResponse,
 	defer logger.Sync()
 	log := logger.Sugar()
 
-	log.Infow("UserInfo()", "Request", request)
+	log.Infow("UserInfo()", "UserAgent", request.UserAgent, "SourceIP", request.SourceIP)
+
+	cognitoSession, err := oauth.Authenticate(aws.StringValue(request.AccessToken), request.ClientContext, false)
+	if err != nil {
+		log.Errorw("unable to authenticate", "Error", err)
+		return nil, err
+	}
 
-	tokenSource, err := oauth.GetOauthTokenSource(ctx, *request.AccessToken)
+	tokenSource, err := cognitoSession.TokenSource(ctx)
 	if err != nil {
 		log.Errorw("unable to obtain oauth token source", "Error", structs.Map(err))
 		return nil, err
@@ -52,17 +171,33 @@ func UserInfo(ctx context.Context, request UserInfoRequest) (*UserInfoResponse,
 		return nil, err
 	}
 
-	userInfoResponse := &UserInfoResponse{}
-	err = json.Unmarshal(body, userInfoResponse)
+	claims := map[string]interface{}{}
+	err = json.Unmarshal(body, &claims)
 	if err != nil {
 		log.Errorw("error unmarshalling json", "Error", err)
 		return nil, err
 	}
 
+	userInfoResponse := newUserInfoResponse(claims)
+
+	// Users confirmed before profiles existed simply have none yet
+	profile, err := users.GetUser(userInfoResponse.Sub)
+	if err != nil && err != users.ErrNotFound {
+		log.Errorw("unable to read user profile", "Sub", userInfoResponse.Sub, "Error", err)
+		return nil, err
+	}
+
+	if profile != nil {
+		userInfoResponse.Roles = profile.Roles
+		userInfoResponse.Tenant = profile.Tenant
+		userInfoResponse.GitHub = profile.GitHub
+		userInfoResponse.Preferences = profile.Preferences
+	}
+
 	log.Infow("Cognito userInfo", "userInfo", userInfoResponse)
 	return userInfoResponse, nil
 }
 
 func main() {
 	lambda.Start(UserInfo)
-}
\ No newline at end of file
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+func VerifyAuthChallenge(ctx context.Context, event events.CognitoEventUserPoolsVerifyAuthChallenge) (events.CognitoEventUserPoolsVerifyAuthChallenge, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With("UserName", event.UserName, "TriggerSource", event.TriggerSource)
+
+	log.Infow("VerifyAuthChallenge()")
+
+	params := event.Request.PrivateChallengeParameters
+	answer, _ := event.Request.ChallengeAnswer.(string)
+
+	expiresAt, err := strconv.ParseInt(params["expires_at"], 10, 64)
+	if err != nil {
+		log.Errorw("invalid challenge expiry", "Error", err)
+		return event, nil
+	}
+
+	expired := time.Now().Unix() >= expiresAt
+	matches := params["code"] != "" && subtle.ConstantTimeCompare([]byte(answer), []byte(params["code"])) == 1
+
+	event.Response.AnswerCorrect = matches && !expired
+
+	log.Infow("auth challenge verified", "AnswerCorrect", event.Response.AnswerCorrect, "Expired", expired)
+
+	return event, nil
+}
+
+func main() {
+	lambda.Start(VerifyAuthChallenge)
+}
@@ -0,0 +1,294 @@
+package cfnresource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/cfn"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// DeadlineMargin is the time left before the Lambda deadline at which a
+	// pending operation is handed over to a fresh invocation.
+	DeadlineMargin = 30 * time.Second
+
+	// MaxContinuations bounds how many times a single request may re-invoke
+	// the function before it is reported as failed.
+	MaxContinuations = 20
+)
+
+// Request is a CloudFormation custom resource event together with the
+// logger that handlers should use while serving it.
+type Request struct {
+	cfn.Event
+	Log *zap.SugaredLogger
+
+	// State is the state passed to Continue by the previous invocation, or
+	// nil when the request was received from CloudFormation.
+	State map[string]string
+}
+
+// Handler implements the lifecycle of a single custom resource type.
+type Handler interface {
+	Create(ctx context.Context, request *Request) (physicalResourceID string, data map[string]interface{}, err error)
+	Update(ctx context.Context, request *Request) (physicalResourceID string, data map[string]interface{}, err error)
+	Delete(ctx context.Context, request *Request) (physicalResourceID string, data map[string]interface{}, err error)
+}
+
+// InProgress is returned by a Handler that could not finish before the
+// Lambda deadline. The Router re-invokes the function asynchronously with
+// State and leaves the CloudFormation response to that invocation.
+type InProgress struct {
+	State map[string]string
+}
+
+func (p *InProgress) Error() string {
+	return fmt.Sprintf("operation still in progress: %v", p.State)
+}
+
+// Continue returns an InProgress error carrying state to the next invocation.
+func Continue(state map[string]string) error {
+	return &InProgress{State: state}
+}
+
+// Invocation is the payload the function receives, either straight from
+// CloudFormation or from a previous invocation continuing a request.
+type Invocation struct {
+	cfn.Event
+	State        map[string]string `json:"ContinuationState,omitempty"`
+	Continuation int               `json:"Continuation,omitempty"`
+}
+
+// Router dispatches custom resource events to the Handler registered for
+// their ResourceType.
+type Router struct {
+	handlers map[string]Handler
+	lambda   lambdaiface.LambdaAPI
+}
+
+// NewRouter returns an empty Router which uses lambdaSvc to re-invoke the
+// function when a Handler returns InProgress.
+func NewRouter(lambdaSvc lambdaiface.LambdaAPI) *Router {
+	return &Router{
+		handlers: map[string]Handler{},
+		lambda:   lambdaSvc,
+	}
+}
+
+// Handle registers handler for events whose ResourceType is resourceType,
+// e.g. "Custom::CognitoDomain".
+func (r *Router) Handle(resourceType string, handler Handler) {
+	r.handlers[resourceType] = handler
+}
+
+func (r *Router) dispatch(ctx context.Context, inv *Invocation) (physicalResourceID string, data map[string]interface{}, err error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar().With(
+		"RequestID", inv.RequestID,
+		"ResourceType", inv.ResourceType,
+		"LogicalResourceID", inv.LogicalResourceID,
+	)
+
+	log.Infow("event received", "Event", inv.Event, "State", inv.State, "Continuation", inv.Continuation)
+
+	request := &Request{Event: inv.Event, Log: log, State: inv.State}
+
+	handler, ok := r.handlers[inv.ResourceType]
+	if !ok {
+		err = fmt.Errorf("unsupported resource type %s", inv.ResourceType)
+		log.Errorw("no handler registered", "Error", err)
+
+		// Never block stack deletion on a resource we don't know how to handle
+		if inv.RequestType == cfn.RequestDelete {
+			return inv.PhysicalResourceID, nil, nil
+		}
+		return
+	}
+
+	switch inv.RequestType {
+	case cfn.RequestCreate:
+		physicalResourceID, data, err = handler.Create(ctx, request)
+	case cfn.RequestUpdate:
+		physicalResourceID, data, err = handler.Update(ctx, request)
+	case cfn.RequestDelete:
+		physicalResourceID, data, err = handler.Delete(ctx, request)
+	default:
+		err = fmt.Errorf("unsupported request type %s", inv.RequestType)
+	}
+
+	if _, ok := err.(*InProgress); ok {
+		log.Infow("custom resource request in progress", "RequestType", inv.RequestType, "Error", err)
+		return
+	}
+
+	if err != nil {
+		log.Errorw("custom resource request failed", "RequestType", inv.RequestType, "Error", err)
+		return
+	}
+
+	log.Infow("custom resource request succeeded", "RequestType", inv.RequestType, "PhysicalResourceID", physicalResourceID, "Data", data)
+
+	return
+}
+
+// Invoke serves a single Lambda invocation. The result is sent to the
+// pre-signed response URL unless the Handler is still in progress, in which
+// case the function is re-invoked to carry on from the returned state.
+func (r *Router) Invoke(ctx context.Context, inv Invocation) (err error) {
+	response := cfn.NewResponse(&inv.Event)
+
+	funcDidPanic := true
+	defer func() {
+		if funcDidPanic {
+			response.Status = cfn.StatusFailed
+			response.Reason = "Function panicked, see log stream for details"
+			response.Send()
+		}
+	}()
+
+	physicalResourceID, data, err := r.dispatch(ctx, &inv)
+	funcDidPanic = false
+
+	if pending, ok := err.(*InProgress); ok {
+		err = r.continueRequest(ctx, &inv, pending)
+		if err == nil {
+			return nil
+		}
+	}
+
+	response.PhysicalResourceID = physicalResourceID
+	response.Data = data
+
+	if response.PhysicalResourceID == "" {
+		response.PhysicalResourceID = inv.PhysicalResourceID
+	}
+	if response.PhysicalResourceID == "" {
+		response.PhysicalResourceID = lambdacontext.LogStreamName
+	}
+
+	if err != nil {
+		response.Status = cfn.StatusFailed
+		response.Reason = err.Error()
+	} else {
+		response.Status = cfn.StatusSuccess
+	}
+
+	return response.Send()
+}
+
+func (r *Router) continueRequest(ctx context.Context, inv *Invocation, pending *InProgress) error {
+	if inv.Continuation >= MaxContinuations {
+		return fmt.Errorf("operation did not complete after %d invocations", inv.Continuation+1)
+	}
+
+	next := &Invocation{
+		Event:        inv.Event,
+		State:        pending.State,
+		Continuation: inv.Continuation + 1,
+	}
+
+	payload, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	functionName := lambdacontext.FunctionName
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		functionName = lc.InvokedFunctionArn
+	}
+
+	_, err = r.lambda.InvokeWithContext(ctx, &awslambda.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		InvocationType: aws.String(awslambda.InvocationTypeEvent),
+		Payload:        payload,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to continue operation: %v", err)
+	}
+
+	return nil
+}
+
+// Start hands the Router over to the Lambda runtime.
+func (r *Router) Start() {
+	lambda.Start(r.Invoke)
+}
+
+// NearDeadline reports whether the invocation has less than DeadlineMargin
+// left to run.
+func (r *Request) NearDeadline(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	return time.Until(deadline) < DeadlineMargin
+}
+
+// Poll calls check every interval until it reports done, fails, or the
+// invocation gets close to its deadline, in which case Poll returns false
+// and the Handler should Continue with enough state to resume polling.
+func (r *Request) Poll(ctx context.Context, interval time.Duration, check func() (done bool, err error)) (bool, error) {
+	for {
+		done, err := check()
+		if err != nil || done {
+			return done, err
+		}
+
+		if r.NearDeadline(ctx) {
+			return false, nil
+		}
+
+		// Never sleep into the margin, the invocation would be killed
+		// before it could hand over to the next one
+		wait, last := interval, false
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := time.Until(deadline) - DeadlineMargin; left < wait {
+				wait, last = left, true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if last {
+			return false, nil
+		}
+	}
+}
+
+// DecodeProperties unmarshals the resource properties of the request into v,
+// which should use json tags named after the template properties.
+func (r *Request) DecodeProperties(v interface{}) error {
+	return decode(r.ResourceProperties, v)
+}
+
+// DecodeOldProperties unmarshals the properties the resource had before an
+// Update into v.
+func (r *Request) DecodeOldProperties(v interface{}) error {
+	return decode(r.OldResourceProperties, v)
+}
+
+func decode(properties map[string]interface{}, v interface{}) error {
+	raw, err := json.Marshal(properties)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid resource properties: %v", err)
+	}
+
+	return nil
+}
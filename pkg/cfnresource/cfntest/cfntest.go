@@ -0,0 +1,344 @@
+// Package cfntest runs custom resource events through a cfnresource.Router
+// against fake AWS clients, recording the calls made and the response sent
+// to CloudFormation, so handlers can be exercised without deploying a stack.
+//
+//	h := cfntest.New()
+//	defer h.Close()
+//
+//	fixture, err := cfntest.LoadFixture("testdata/create.json")
+//	...
+//	response, err := h.Run(newRouter(h.Cognito, h.Route53, h.SSM, h.Lambda), fixture)
+//	...
+//	err = h.Check(fixture, response)
+package cfntest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/cfn"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// LogStreamName stands in for the log stream of the Lambda function.
+const LogStreamName = "2019/10/01/[$LATEST]0123456789abcdef0123456789abcdef"
+
+// Fixture is a recorded custom resource event together with the failures the
+// fakes should inject and the outcome expected from the handler.
+type Fixture struct {
+	Event cfn.Event `json:"Event"`
+
+	// HostedZones are the zones served by the fake Route53.
+	HostedZones []*route53.HostedZone `json:"HostedZones"`
+
+	// Parameters are in the fake SSM before the event is sent, as if
+	// published by an earlier event. Their version is 1.
+	Parameters map[string]string `json:"Parameters"`
+
+	// Errors maps a call such as "route53.ChangeResourceRecordSets" to the
+	// AWS error it fails with.
+	Errors map[string]FixtureError `json:"Errors"`
+
+	// PendingChanges and PendingDomains are how many times the fakes report
+	// a record change or the user pool domain as not ready yet.
+	PendingChanges int `json:"PendingChanges"`
+	PendingDomains int `json:"PendingDomains"`
+
+	// Timeout is how long each invocation may run, such as "10s". Anything
+	// below cfnresource.DeadlineMargin makes every wait hand over to the
+	// next invocation after its first check. The default is 5m.
+	Timeout string `json:"Timeout"`
+
+	ExpectedCalls  []string       `json:"ExpectedCalls"`
+	ExpectedStatus cfn.StatusType `json:"ExpectedStatus"`
+
+	// ExpectedContinuations, when given, are the invocations the handler
+	// should have re-invoked the function with, in order.
+	ExpectedContinuations []Continuation `json:"ExpectedContinuations"`
+
+	// ExpectedParameters, when given, are all the parameters the fake SSM
+	// should be left with.
+	ExpectedParameters map[string]string `json:"ExpectedParameters"`
+}
+
+// FixtureError is an injected AWS error. The call succeeds After times
+// before it starts failing.
+type FixtureError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+	After   int    `json:"After"`
+}
+
+// Continuation is the part of a continued invocation a fixture checks, the
+// event has to be the one the fixture started with.
+type Continuation struct {
+	State        map[string]string `json:"State"`
+	Continuation int               `json:"Continuation"`
+}
+
+// LoadFixture reads a Fixture from a JSON file.
+func LoadFixture(path string) (*Fixture, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &Fixture{}
+	if err := json.Unmarshal(raw, fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %v", path, err)
+	}
+
+	return fixture, nil
+}
+
+// Response is the body CloudFormation receives on the pre-signed URL.
+type Response struct {
+	Status             cfn.StatusType         `json:"Status"`
+	RequestID          string                 `json:"RequestId"`
+	LogicalResourceID  string                 `json:"LogicalResourceId"`
+	StackID            string                 `json:"StackId"`
+	PhysicalResourceID string                 `json:"PhysicalResourceId"`
+	Reason             string                 `json:"Reason"`
+	Data               map[string]interface{} `json:"Data"`
+}
+
+// Recorder keeps the sequence of AWS calls made by the fakes and the errors
+// they were told to fail with.
+type Recorder struct {
+	mu     sync.Mutex
+	calls  []string
+	counts map[string]int
+	errors map[string]injectedError
+}
+
+type injectedError struct {
+	err   error
+	after int
+}
+
+// Call records name and returns the error injected for it, if any.
+func (r *Recorder) Call(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counts == nil {
+		r.counts = map[string]int{}
+	}
+
+	r.calls = append(r.calls, name)
+	r.counts[name]++
+
+	injected, ok := r.errors[name]
+	if !ok || r.counts[name] <= injected.after {
+		return nil
+	}
+	return injected.err
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.calls...)
+}
+
+// Fail makes every later call to name return err.
+func (r *Recorder) Fail(name string, err error) {
+	r.FailAfter(name, 0, err)
+}
+
+// FailAfter lets the first after calls to name succeed and makes every later
+// one return err.
+func (r *Recorder) FailAfter(name string, after int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.errors == nil {
+		r.errors = map[string]injectedError{}
+	}
+	r.errors[name] = injectedError{err: err, after: after}
+}
+
+// Harness owns the fakes and the local stub standing in for the pre-signed
+// S3 response URL.
+type Harness struct {
+	Recorder *Recorder
+	Cognito  *FakeCognito
+	Route53  *FakeRoute53
+	SSM      *FakeSSM
+	Lambda   *FakeLambda
+
+	// Continuations are the invocations the handler re-invoked the
+	// function with, in order.
+	Continuations []*cfnresource.Invocation
+
+	server    *httptest.Server
+	mu        sync.Mutex
+	responses []*Response
+}
+
+// New starts a Harness. Close must be called to stop the response stub.
+func New() *Harness {
+	recorder := &Recorder{}
+	h := &Harness{
+		Recorder: recorder,
+		Cognito:  &FakeCognito{Recorder: recorder},
+		Route53:  &FakeRoute53{Recorder: recorder},
+		SSM:      &FakeSSM{Recorder: recorder, Parameters: map[string]string{}},
+		Lambda:   &FakeLambda{Recorder: recorder},
+	}
+
+	h.server = httptest.NewServer(http.HandlerFunc(h.receive))
+
+	// Failed creates report the log stream as their physical resource id
+	if lambdacontext.LogStreamName == "" {
+		lambdacontext.LogStreamName = LogStreamName
+	}
+
+	return h
+}
+
+// Close stops the response stub.
+func (h *Harness) Close() {
+	h.server.Close()
+}
+
+func (h *Harness) receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := &Response{}
+	if err := json.NewDecoder(r.Body).Decode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	h.responses = append(h.responses, response)
+	h.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Run sends the fixture event through router, following any continuation the
+// handler asks for, and returns the response it sent to CloudFormation.
+func (h *Harness) Run(router *cfnresource.Router, fixture *Fixture) (*Response, error) {
+	h.Route53.HostedZones = fixture.HostedZones
+	h.Route53.PendingChanges = fixture.PendingChanges
+	h.Cognito.PendingDomains = fixture.PendingDomains
+	for name, value := range fixture.Parameters {
+		h.SSM.Parameters[name] = value
+	}
+	for name, e := range fixture.Errors {
+		h.Recorder.FailAfter(name, e.After, awserr.New(e.Code, e.Message, nil))
+	}
+
+	timeout := 5 * time.Minute
+	if fixture.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(fixture.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid Timeout: %v", err)
+		}
+	}
+
+	event := fixture.Event
+	event.ResponseURL = h.server.URL
+
+	invocation := cfnresource.Invocation{Event: event}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := router.Invoke(ctx, invocation)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		next := h.Lambda.next()
+		if next == nil {
+			break
+		}
+		// Handlers add to the state they resume from, keep what was sent
+		recorded := *next
+		recorded.State = map[string]string{}
+		for key, value := range next.State {
+			recorded.State[key] = value
+		}
+		h.Continuations = append(h.Continuations, &recorded)
+
+		invocation = *next
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.responses) != 1 {
+		return nil, fmt.Errorf("expected exactly one response, got %d", len(h.responses))
+	}
+
+	return h.responses[0], nil
+}
+
+// Check compares the recorded calls, the response and the parameters left
+// in SSM with what the fixture expects.
+func (h *Harness) Check(fixture *Fixture, response *Response) error {
+	if calls := h.Recorder.Calls(); !reflect.DeepEqual(calls, fixture.ExpectedCalls) {
+		return fmt.Errorf("unexpected calls:\n  got:  %v\n  want: %v", calls, fixture.ExpectedCalls)
+	}
+
+	if response.Status != fixture.ExpectedStatus {
+		return fmt.Errorf("unexpected status %s (reason: %s), want %s", response.Status, response.Reason, fixture.ExpectedStatus)
+	}
+
+	if response.RequestID != fixture.Event.RequestID || response.LogicalResourceID != fixture.Event.LogicalResourceID {
+		return fmt.Errorf("response doesn't match request %s/%s", fixture.Event.RequestID, fixture.Event.LogicalResourceID)
+	}
+
+	if response.PhysicalResourceID == "" {
+		return fmt.Errorf("response is missing a PhysicalResourceId")
+	}
+
+	if fixture.ExpectedContinuations != nil {
+		if err := h.checkContinuations(fixture); err != nil {
+			return err
+		}
+	}
+
+	if fixture.ExpectedParameters != nil && !reflect.DeepEqual(h.SSM.Parameters, fixture.ExpectedParameters) {
+		return fmt.Errorf("unexpected parameters:\n  got:  %v\n  want: %v", h.SSM.Parameters, fixture.ExpectedParameters)
+	}
+
+	return nil
+}
+
+// checkContinuations compares the continued invocations with the fixture's,
+// and makes sure each carried the original event on.
+func (h *Harness) checkContinuations(fixture *Fixture) error {
+	if len(h.Continuations) != len(fixture.ExpectedContinuations) {
+		return fmt.Errorf("expected %d continuations, got %d", len(fixture.ExpectedContinuations), len(h.Continuations))
+	}
+
+	for i, next := range h.Continuations {
+		want := fixture.ExpectedContinuations[i]
+		if next.Continuation != want.Continuation || !reflect.DeepEqual(next.State, want.State) {
+			return fmt.Errorf("unexpected continuation %d:\n  got:  %d %v\n  want: %d %v", i, next.Continuation, next.State, want.Continuation, want.State)
+		}
+		if next.RequestID != fixture.Event.RequestID || next.RequestType != fixture.Event.RequestType ||
+			!reflect.DeepEqual(next.ResourceProperties, fixture.Event.ResourceProperties) {
+			return fmt.Errorf("continuation %d doesn't carry the original event", i)
+		}
+	}
+
+	return nil
+}
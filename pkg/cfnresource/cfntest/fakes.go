@@ -0,0 +1,323 @@
+package cfntest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider/cognitoidentityprovideriface"
+	awslambda "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"go.smartmachine.io/awsci-api/pkg/cfnresource"
+	"sync"
+)
+
+// CloudFrontDomain is the distribution the fake user pool domain is served by.
+const CloudFrontDomain = "d111111abcdef8.cloudfront.net"
+
+// FakeCognito answers the user pool calls made by the custom resources.
+// Calls it doesn't implement panic through the embedded nil interface.
+type FakeCognito struct {
+	cognitoidentityprovideriface.CognitoIdentityProviderAPI
+	Recorder *Recorder
+
+	// PendingDomains is how many times waiting for the user pool domain
+	// finds it still being created.
+	PendingDomains int
+}
+
+func (f *FakeCognito) CreateUserPoolDomain(input *cognito.CreateUserPoolDomainInput) (*cognito.CreateUserPoolDomainOutput, error) {
+	if err := f.Recorder.Call("cognito.CreateUserPoolDomain"); err != nil {
+		return nil, err
+	}
+	return &cognito.CreateUserPoolDomainOutput{CloudFrontDomain: aws.String(CloudFrontDomain)}, nil
+}
+
+func (f *FakeCognito) DescribeUserPoolDomain(input *cognito.DescribeUserPoolDomainInput) (*cognito.DescribeUserPoolDomainOutput, error) {
+	if err := f.Recorder.Call("cognito.DescribeUserPoolDomain"); err != nil {
+		return nil, err
+	}
+	return &cognito.DescribeUserPoolDomainOutput{
+		DomainDescription: &cognito.DomainDescriptionType{
+			Domain:                 input.Domain,
+			CloudFrontDistribution: aws.String(CloudFrontDomain),
+			Status:                 aws.String(cognito.DomainStatusTypeActive),
+		},
+	}, nil
+}
+
+func (f *FakeCognito) DescribeUserPoolDomainWithContext(ctx aws.Context, input *cognito.DescribeUserPoolDomainInput, opts ...request.Option) (*cognito.DescribeUserPoolDomainOutput, error) {
+	output, err := f.DescribeUserPoolDomain(input)
+	if err == nil && f.PendingDomains > 0 {
+		f.PendingDomains--
+		output.DomainDescription.Status = aws.String(cognito.DomainStatusTypeCreating)
+	}
+	return output, err
+}
+
+func (f *FakeCognito) DeleteUserPoolDomain(input *cognito.DeleteUserPoolDomainInput) (*cognito.DeleteUserPoolDomainOutput, error) {
+	if err := f.Recorder.Call("cognito.DeleteUserPoolDomain"); err != nil {
+		return nil, err
+	}
+	return &cognito.DeleteUserPoolDomainOutput{}, nil
+}
+
+func (f *FakeCognito) CreateResourceServer(input *cognito.CreateResourceServerInput) (*cognito.CreateResourceServerOutput, error) {
+	if err := f.Recorder.Call("cognito.CreateResourceServer"); err != nil {
+		return nil, err
+	}
+	return &cognito.CreateResourceServerOutput{
+		ResourceServer: &cognito.ResourceServerType{
+			Identifier: input.Identifier,
+			Name:       input.Name,
+			Scopes:     input.Scopes,
+			UserPoolId: input.UserPoolId,
+		},
+	}, nil
+}
+
+func (f *FakeCognito) DeleteResourceServer(input *cognito.DeleteResourceServerInput) (*cognito.DeleteResourceServerOutput, error) {
+	if err := f.Recorder.Call("cognito.DeleteResourceServer"); err != nil {
+		return nil, err
+	}
+	return &cognito.DeleteResourceServerOutput{}, nil
+}
+
+func (f *FakeCognito) CreateUserPoolClientWithContext(ctx aws.Context, input *cognito.CreateUserPoolClientInput, opts ...request.Option) (*cognito.CreateUserPoolClientOutput, error) {
+	if err := f.Recorder.Call("cognito.CreateUserPoolClient"); err != nil {
+		return nil, err
+	}
+	client := &cognito.UserPoolClientType{
+		UserPoolId: input.UserPoolId,
+		ClientId:   aws.String(*input.ClientName + "-client-id"),
+		ClientName: input.ClientName,
+	}
+	if aws.BoolValue(input.GenerateSecret) {
+		client.ClientSecret = aws.String(*input.ClientName + "-client-secret")
+	}
+	return &cognito.CreateUserPoolClientOutput{UserPoolClient: client}, nil
+}
+
+func (f *FakeCognito) DescribeUserPoolClientWithContext(ctx aws.Context, input *cognito.DescribeUserPoolClientInput, opts ...request.Option) (*cognito.DescribeUserPoolClientOutput, error) {
+	if err := f.Recorder.Call("cognito.DescribeUserPoolClient"); err != nil {
+		return nil, err
+	}
+	return &cognito.DescribeUserPoolClientOutput{
+		UserPoolClient: &cognito.UserPoolClientType{
+			UserPoolId:                 input.UserPoolId,
+			ClientId:                   input.ClientId,
+			SupportedIdentityProviders: []*string{aws.String("COGNITO")},
+		},
+	}, nil
+}
+
+func (f *FakeCognito) UpdateUserPoolClient(input *cognito.UpdateUserPoolClientInput) (*cognito.UpdateUserPoolClientOutput, error) {
+	if err := f.Recorder.Call("cognito.UpdateUserPoolClient"); err != nil {
+		return nil, err
+	}
+	return &cognito.UpdateUserPoolClientOutput{
+		UserPoolClient: &cognito.UserPoolClientType{
+			UserPoolId: input.UserPoolId,
+			ClientId:   input.ClientId,
+			ClientName: input.ClientName,
+		},
+	}, nil
+}
+
+func (f *FakeCognito) UpdateUserPoolClientWithContext(ctx aws.Context, input *cognito.UpdateUserPoolClientInput, opts ...request.Option) (*cognito.UpdateUserPoolClientOutput, error) {
+	return f.UpdateUserPoolClient(input)
+}
+
+func (f *FakeCognito) DeleteUserPoolClientWithContext(ctx aws.Context, input *cognito.DeleteUserPoolClientInput, opts ...request.Option) (*cognito.DeleteUserPoolClientOutput, error) {
+	if err := f.Recorder.Call("cognito.DeleteUserPoolClient"); err != nil {
+		return nil, err
+	}
+	return &cognito.DeleteUserPoolClientOutput{}, nil
+}
+
+func (f *FakeCognito) CreateIdentityProviderWithContext(ctx aws.Context, input *cognito.CreateIdentityProviderInput, opts ...request.Option) (*cognito.CreateIdentityProviderOutput, error) {
+	if err := f.Recorder.Call("cognito.CreateIdentityProvider"); err != nil {
+		return nil, err
+	}
+	return &cognito.CreateIdentityProviderOutput{
+		IdentityProvider: &cognito.IdentityProviderType{
+			UserPoolId:   input.UserPoolId,
+			ProviderName: input.ProviderName,
+			ProviderType: input.ProviderType,
+		},
+	}, nil
+}
+
+func (f *FakeCognito) UpdateIdentityProviderWithContext(ctx aws.Context, input *cognito.UpdateIdentityProviderInput, opts ...request.Option) (*cognito.UpdateIdentityProviderOutput, error) {
+	if err := f.Recorder.Call("cognito.UpdateIdentityProvider"); err != nil {
+		return nil, err
+	}
+	return &cognito.UpdateIdentityProviderOutput{
+		IdentityProvider: &cognito.IdentityProviderType{
+			UserPoolId:   input.UserPoolId,
+			ProviderName: input.ProviderName,
+		},
+	}, nil
+}
+
+func (f *FakeCognito) DeleteIdentityProviderWithContext(ctx aws.Context, input *cognito.DeleteIdentityProviderInput, opts ...request.Option) (*cognito.DeleteIdentityProviderOutput, error) {
+	if err := f.Recorder.Call("cognito.DeleteIdentityProvider"); err != nil {
+		return nil, err
+	}
+	return &cognito.DeleteIdentityProviderOutput{}, nil
+}
+
+// FakeRoute53 serves HostedZones and accepts every record change, reporting
+// it as pending PendingChanges times before it is in sync.
+type FakeRoute53 struct {
+	route53iface.Route53API
+	Recorder       *Recorder
+	HostedZones    []*route53.HostedZone
+	PendingChanges int
+}
+
+func (f *FakeRoute53) ListHostedZonesPages(input *route53.ListHostedZonesInput, fn func(*route53.ListHostedZonesOutput, bool) bool) error {
+	if err := f.Recorder.Call("route53.ListHostedZones"); err != nil {
+		return err
+	}
+	fn(&route53.ListHostedZonesOutput{HostedZones: f.HostedZones}, true)
+	return nil
+}
+
+func (f *FakeRoute53) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if err := f.Recorder.Call("route53.ChangeResourceRecordSets"); err != nil {
+		return nil, err
+	}
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Id:     aws.String("/change/C2682N5HXP0BZ4"),
+			Status: aws.String(route53.ChangeStatusPending),
+		},
+	}, nil
+}
+
+func (f *FakeRoute53) GetChangeWithContext(ctx aws.Context, input *route53.GetChangeInput, opts ...request.Option) (*route53.GetChangeOutput, error) {
+	if err := f.Recorder.Call("route53.GetChange"); err != nil {
+		return nil, err
+	}
+	status := route53.ChangeStatusInsync
+	if f.PendingChanges > 0 {
+		f.PendingChanges--
+		status = route53.ChangeStatusPending
+	}
+	return &route53.GetChangeOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Id:     input.Id,
+			Status: aws.String(status),
+		},
+	}, nil
+}
+
+// FakeSSM keeps parameters in memory, counting their versions like SSM.
+type FakeSSM struct {
+	ssmiface.SSMAPI
+	Recorder   *Recorder
+	Parameters map[string]string
+
+	versions map[string]int64
+}
+
+func (f *FakeSSM) PutParameterWithContext(ctx aws.Context, input *ssm.PutParameterInput, opts ...request.Option) (*ssm.PutParameterOutput, error) {
+	if err := f.Recorder.Call("ssm.PutParameter"); err != nil {
+		return nil, err
+	}
+	if _, ok := f.Parameters[*input.Name]; ok && !aws.BoolValue(input.Overwrite) {
+		return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "parameter already exists", nil)
+	}
+	if f.versions == nil {
+		f.versions = map[string]int64{}
+	}
+	if _, ok := f.Parameters[*input.Name]; !ok {
+		f.versions[*input.Name] = 0
+	} else if f.versions[*input.Name] == 0 {
+		// Seeded by the fixture
+		f.versions[*input.Name] = 1
+	}
+	f.Parameters[*input.Name] = *input.Value
+	f.versions[*input.Name]++
+	return &ssm.PutParameterOutput{Version: aws.Int64(f.versions[*input.Name])}, nil
+}
+
+func (f *FakeSSM) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	if err := f.Recorder.Call("ssm.GetParameter"); err != nil {
+		return nil, err
+	}
+	value, ok := f.Parameters[*input.Name]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "parameter not found", nil)
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(value)},
+	}, nil
+}
+
+func (f *FakeSSM) DeleteParametersWithContext(ctx aws.Context, input *ssm.DeleteParametersInput, opts ...request.Option) (*ssm.DeleteParametersOutput, error) {
+	if err := f.Recorder.Call("ssm.DeleteParameters"); err != nil {
+		return nil, err
+	}
+	output := &ssm.DeleteParametersOutput{}
+	for _, name := range input.Names {
+		if _, ok := f.Parameters[*name]; ok {
+			delete(f.Parameters, *name)
+			output.DeletedParameters = append(output.DeletedParameters, name)
+		} else {
+			output.InvalidParameters = append(output.InvalidParameters, name)
+		}
+	}
+	return output, nil
+}
+
+// FakeLambda queues the continuations a handler asks for, for the Harness
+// to run as the next invocation.
+type FakeLambda struct {
+	lambdaiface.LambdaAPI
+	Recorder *Recorder
+
+	mu      sync.Mutex
+	pending []*cfnresource.Invocation
+}
+
+func (f *FakeLambda) InvokeWithContext(ctx aws.Context, input *awslambda.InvokeInput, opts ...request.Option) (*awslambda.InvokeOutput, error) {
+	if err := f.Recorder.Call("lambda.Invoke"); err != nil {
+		return nil, err
+	}
+
+	// A synchronous invoke would wait for the continuation to finish
+	if aws.StringValue(input.InvocationType) != awslambda.InvocationTypeEvent {
+		return nil, fmt.Errorf("continuation invoked with InvocationType %s", aws.StringValue(input.InvocationType))
+	}
+
+	invocation := &cfnresource.Invocation{}
+	if err := json.Unmarshal(input.Payload, invocation); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.pending = append(f.pending, invocation)
+	f.mu.Unlock()
+
+	return &awslambda.InvokeOutput{StatusCode: aws.Int64(202)}, nil
+}
+
+func (f *FakeLambda) next() *cfnresource.Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.pending) == 0 {
+		return nil
+	}
+	next := f.pending[0]
+	f.pending = f.pending[1:]
+	return next
+}
@@ -0,0 +1,50 @@
+package cfnresource
+
+import (
+	"fmt"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Rollback records how to undo each completed step of a Create so that a
+// failure part way through doesn't leave orphaned resources behind.
+type Rollback struct {
+	log   *zap.SugaredLogger
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	name string
+	undo func() error
+}
+
+func NewRollback(log *zap.SugaredLogger) *Rollback {
+	return &Rollback{log: log}
+}
+
+// Add records undo as the way to revert the step called name.
+func (r *Rollback) Add(name string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{name: name, undo: undo})
+}
+
+// Run undoes the recorded steps in reverse order after cause made the Create
+// fail. The returned error carries cause along with any step that couldn't
+// be undone.
+func (r *Rollback) Run(cause error) error {
+	err := cause
+
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+
+		r.log.Infow("rolling back", "Step", step.name)
+
+		if undoErr := step.undo(); undoErr != nil {
+			r.log.Errorw("rollback failed", "Step", step.name, "Error", undoErr)
+			err = multierr.Append(err, fmt.Errorf("rollback of %s failed: %v", step.name, undoErr))
+		}
+	}
+
+	r.steps = nil
+
+	return err
+}
@@ -0,0 +1,128 @@
+package mail
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/aws/aws-sdk-go/service/ses/sesiface"
+	"github.com/fatih/structs"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultFrom is the sender of our emails unless MAIL_FROM says otherwise.
+	DefaultFrom = "AWSci <no-reply@awsci.io>"
+
+	charset = "UTF-8"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Sender delivers emails on behalf of the API.
+type Sender interface {
+	Send(message Message) error
+}
+
+// NewSender returns the SES sender, or a StubSender when MAIL_SENDER is
+// "stub" so functions can run locally without sending anything.
+func NewSender() Sender {
+	if os.Getenv("MAIL_SENDER") == "stub" {
+		// Setup structured logging
+		logger, _ := zap.NewProduction()
+		defer logger.Sync()
+
+		logger.Sugar().Warnw("MAIL_SENDER is stub, emails are NOT being sent", "Sender", "StubSender")
+		return &StubSender{}
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = DefaultFrom
+	}
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return &SESSender{From: from, SES: ses.New(sess)}
+}
+
+type SESSender struct {
+	From string
+	SES  sesiface.SESAPI
+}
+
+func (s *SESSender) Send(message Message) error {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	body := &ses.Body{}
+	if message.HTML != "" {
+		body.Html = &ses.Content{Charset: aws.String(charset), Data: aws.String(message.HTML)}
+	}
+	if message.Text != "" {
+		body.Text = &ses.Content{Charset: aws.String(charset), Data: aws.String(message.Text)}
+	}
+
+	sendEmailRequest := &ses.SendEmailInput{
+		Source:      aws.String(s.From),
+		Destination: &ses.Destination{ToAddresses: []*string{aws.String(message.To)}},
+		Message: &ses.Message{
+			Subject: &ses.Content{Charset: aws.String(charset), Data: aws.String(message.Subject)},
+			Body:    body,
+		},
+	}
+
+	// The request is not logged as a whole, the body holds sign in secrets
+	log.Infow("SES SendEmail Request", "To", message.To, "Subject", message.Subject)
+
+	sendEmailResponse, err := s.SES.SendEmail(sendEmailRequest)
+	if err != nil {
+		log.Errorw("SES SendEmail Error", "Error", err)
+		return err
+	}
+
+	log.Infow("SES SendEmail Response", "Response", structs.Map(sendEmailResponse))
+
+	return nil
+}
+
+// StubSender keeps messages in memory instead of sending them, warning about
+// every one it drops so a stub left on in production doesn't go unnoticed.
+type StubSender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *StubSender) Send(message Message) error {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+
+	// Only the envelope, the body holds sign in secrets
+	logger.Sugar().Warnw("StubSender dropped email, it was NOT sent", "To", message.To, "Subject", message.Subject)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, message)
+
+	return nil
+}
+
+// Messages returns everything sent so far.
+func (s *StubSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message{}, s.messages...)
+}
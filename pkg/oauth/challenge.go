@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"time"
+)
+
+const challengeTableName = "cognito_challenges"
+
+var ErrChallengeNotFound = errors.New("challenge not found or expired")
+
+// Challenge keeps the Cognito session of a sign in that is waiting for the
+// user to answer a challenge, so the answer can arrive in another request.
+type Challenge struct {
+	ChallengeId   string            `json:"challenge_id"`
+	ChallengeName string            `json:"challenge_name"`
+	Username      string            `json:"username"`
+	Session       string            `json:"session"`
+	Parameters    map[string]string `json:"parameters,omitempty"`
+	// ExpiresAt is an epoch timestamp, the table's TTL attribute.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func challengeDB() *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return dynamodb.New(sess)
+}
+
+func (challenge Challenge) SaveChallenge() error {
+	item, err := dynamodbattribute.MarshalMap(challenge)
+	if err != nil {
+		return err
+	}
+
+	_, err = challengeDB().PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(challengeTableName),
+	})
+
+	return err
+}
+
+// GetChallenge returns the challenge, treating expired items the TTL hasn't
+// removed yet as gone.
+func GetChallenge(challengeId string) (*Challenge, error) {
+	getItemResponse, err := challengeDB().GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(challengeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"challenge_id": {S: aws.String(challengeId)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if getItemResponse.Item == nil {
+		return nil, ErrChallengeNotFound
+	}
+
+	challenge := &Challenge{}
+	err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() >= challenge.ExpiresAt {
+		return nil, ErrChallengeNotFound
+	}
+
+	return challenge, nil
+}
+
+func DeleteChallenge(challengeId string) error {
+	_, err := challengeDB().DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(challengeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"challenge_id": {S: aws.String(challengeId)},
+		},
+	})
+
+	return err
+}
@@ -0,0 +1,128 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"io/ioutil"
+	"time"
+)
+
+func NewCognitoClient() *cognito.CognitoIdentityProvider {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return cognito.New(sess)
+}
+
+// NewCognitoSession turns the tokens of a sign in through the Cognito API,
+// rather than the hosted UI, into a session for user.
+func NewCognitoSession(user, provider string, client ClientContext, result *cognito.AuthenticationResultType) CognitoSession {
+	return CognitoSession{
+		User:         user,
+		Provider:     provider,
+		UserAgent:    client.UserAgent,
+		SourceIP:     client.SourceIP,
+		AccessToken:  aws.StringValue(result.AccessToken),
+		IdToken:      aws.StringValue(result.IdToken),
+		TokenType:    aws.StringValue(result.TokenType),
+		RefreshToken: aws.StringValue(result.RefreshToken),
+		Expiry:       time.Now().Add(time.Duration(aws.Int64Value(result.ExpiresIn)) * time.Second),
+	}
+}
+
+// CurrentAccessToken returns the session's Cognito access token, refreshing
+// it when it has expired.
+func (cognitoSession *CognitoSession) CurrentAccessToken(ctx context.Context) (string, error) {
+	tokenSource, err := cognitoSession.TokenSource(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := tokenSource.Token()
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// ExchangeCode trades a hosted UI authorization code for a new, unsaved
+// session of the user who signed in.
+func ExchangeCode(ctx context.Context, code, provider string, client ClientContext) (*CognitoSession, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	cognitoConfig, err := NewCognitoConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cognitoConfig.Exchange(ctx, code)
+	if err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); ok {
+			return nil, fmt.Errorf("oauth2 token exchange error")
+		}
+		return nil, fmt.Errorf(err.Error())
+	}
+
+	// The tokens themselves are secrets
+	log.Infow("obtained token", "TokenType", token.TokenType, "Expiry", token.Expiry)
+
+	tokenSource := cognitoConfig.TokenSource(ctx, token)
+	oauthClient := oauth2.NewClient(ctx, tokenSource)
+
+	resp, err := oauthClient.Get("https://auth.awsci.io/oauth2/userInfo")
+
+	if err != nil {
+		return nil, util.NewError(fmt.Sprintf("cognito userInfo failed: %+v", err), 400)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorw("error reading body", "Error", err)
+		return nil, err
+	}
+
+	userInfo := struct {
+		Username string `json:"username"`
+	}{}
+	err = json.Unmarshal(body, &userInfo)
+	if err != nil {
+		log.Errorw("error unmarshalling json", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("Cognito userInfo", "Username", userInfo.Username)
+
+	if userInfo.Username == "" {
+		return nil, util.NewError("cognito userInfo has no username", 400)
+	}
+
+	curTok, err := tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CognitoSession{
+		User:         userInfo.Username,
+		Provider:     provider,
+		UserAgent:    client.UserAgent,
+		SourceIP:     client.SourceIP,
+		AccessToken:  curTok.AccessToken,
+		IdToken:      idToken(curTok),
+		TokenType:    curTok.TokenType,
+		RefreshToken: curTok.RefreshToken,
+		Expiry:       curTok.Expiry,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionCookieName is only sent back to the API host, __Host- makes
+	// browsers insist on Secure, Path=/ and no Domain.
+	SessionCookieName = "__Host-awsci_session"
+
+	// CSRFCookieName is shared with the SPA on the parent domain, which
+	// reads it and echoes it in the X-CSRF-Token header.
+	CSRFCookieName = "awsci_csrf"
+	csrfDomain     = "awsci.io"
+
+	cookieMaxAge = 30 * 24 * time.Hour
+)
+
+var (
+	ErrNotAuthenticated = util.NewError("an access token or session cookie is required", 401)
+	ErrCSRF             = util.NewError("the CSRF token is missing or doesn't match", 403)
+)
+
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSessionCookies makes the session usable from a browser, returning the
+// Set-Cookie headers and the CSRF token. The session still has to be saved.
+func (cognitoSession *CognitoSession) NewSessionCookies() (cookies []string, csrfToken string, err error) {
+	if cognitoSession.SessionId == "" {
+		if err = cognitoSession.SaveSession(); err != nil {
+			return
+		}
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return
+	}
+	csrfToken, err = randomToken()
+	if err != nil {
+		return
+	}
+
+	cognitoSession.CookieHash = hashToken(secret)
+
+	session := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    cognitoSession.SessionId + "." + secret,
+		Path:     "/",
+		MaxAge:   int(cookieMaxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	csrf := &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   csrfDomain,
+		MaxAge:   int(cookieMaxAge.Seconds()),
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	cookies = []string{session.String(), csrf.String()}
+	return
+}
+
+// ClearSessionCookies returns the Set-Cookie headers that remove both
+// cookies again.
+func ClearSessionCookies() []string {
+	session := &http.Cookie{Name: SessionCookieName, Path: "/", MaxAge: -1, Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode}
+	csrf := &http.Cookie{Name: CSRFCookieName, Path: "/", Domain: csrfDomain, MaxAge: -1, Secure: true, SameSite: http.SameSiteStrictMode}
+
+	return []string{session.String(), csrf.String()}
+}
+
+func requestCookie(header, name string) string {
+	request := &http.Request{Header: http.Header{"Cookie": {header}}}
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Authenticate finds the session of a request, from the bearer token if
+// there is one and the session cookie otherwise. Cookies are sent by the
+// browser on their own, so requests that change anything must also pass
+// the double submit CSRF check.
+func Authenticate(bearerToken string, client ClientContext, stateChanging bool) (*CognitoSession, error) {
+	if bearerToken != "" {
+		return GetSession(bearerToken)
+	}
+
+	value := requestCookie(client.Cookie, SessionCookieName)
+	dot := strings.LastIndex(value, ".")
+	if dot < 0 {
+		return nil, ErrNotAuthenticated
+	}
+
+	if stateChanging {
+		csrf := requestCookie(client.Cookie, CSRFCookieName)
+		if csrf == "" || subtle.ConstantTimeCompare([]byte(csrf), []byte(client.CSRFToken)) != 1 {
+			return nil, ErrCSRF
+		}
+	}
+
+	cognitoSession, err := GetSessionById(value[:dot])
+	if err != nil {
+		return nil, err
+	}
+
+	if cognitoSession.CookieHash == "" || subtle.ConstantTimeCompare([]byte(hashToken(value[dot+1:])), []byte(cognitoSession.CookieHash)) != 1 {
+		return nil, ErrSessionNotFound
+	}
+
+	return cognitoSession, nil
+}
@@ -0,0 +1,312 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// deviceCodeTableName is keyed by device_code_hash, with a global
+	// secondary index on user_code and expires_at as its TTL attribute.
+	deviceCodeTableName = "device_codes"
+	userCodeIndex       = "UserCodeIndex"
+
+	// GrantTypeDeviceCode is the grant of RFC 8628 section 3.4.
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// VerificationURI is the page users enter their user code on.
+	VerificationURI = "https://awsci.io/device"
+
+	DeviceCodeValidity = 10 * time.Minute
+	// DevicePollInterval is the seconds clients wait between polls, every
+	// slow_down adds another five.
+	DevicePollInterval = 5
+
+	// userCodeAlphabet leaves out vowels and look-alikes, RFC 8628 6.1.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// The states of a device authorization.
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// The error responses of RFC 8628 section 3.5.
+var (
+	ErrAuthorizationPending = util.NewError("authorization_pending", 400)
+	ErrSlowDown             = util.NewError("slow_down", 400)
+	ErrAccessDenied         = util.NewError("access_denied", 400)
+	ErrExpiredToken         = util.NewError("expired_token", 400)
+	ErrInvalidUserCode      = util.NewError("the code is invalid or has expired", 404)
+)
+
+// DeviceAuthorization is a pending device flow. Only the hash of the device
+// code is kept, the user code is what the user types in.
+type DeviceAuthorization struct {
+	DeviceCodeHash string    `json:"device_code_hash"`
+	UserCode       string    `json:"user_code"`
+	Status         string    `json:"status"`
+	Interval       int64     `json:"interval"`
+	LastPolledAt   int64     `json:"last_polled_at,omitempty"`
+	SessionId      string    `json:"session_id,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	SourceIP       string    `json:"source_ip,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	// ExpiresAt is an epoch timestamp, the table's TTL attribute. Items
+	// linger for a while after it, so it is checked on every read.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode drops the dash and whatever else users type along with
+// the code, RFC 8628 section 6.1.
+func NormalizeUserCode(userCode string) string {
+	normalized := []rune{}
+	for _, r := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			normalized = append(normalized, r)
+		}
+	}
+	return string(normalized)
+}
+
+// FormatUserCode splits the code in two halves for display.
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// NewDeviceAuthorization starts a device flow for client, returning the
+// device code the client polls with.
+func NewDeviceAuthorization(client ClientContext) (string, *DeviceAuthorization, error) {
+	deviceCode, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	userCode, err := newUserCode()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	device := &DeviceAuthorization{
+		DeviceCodeHash: hashToken(deviceCode),
+		UserCode:       userCode,
+		Status:         DeviceStatusPending,
+		Interval:       DevicePollInterval,
+		UserAgent:      client.UserAgent,
+		SourceIP:       client.SourceIP,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(DeviceCodeValidity).Unix(),
+	}
+
+	item, err := dynamodbattribute.MarshalMap(device)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = sessionDB().PutItem(&dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(deviceCodeTableName),
+		ConditionExpression: aws.String("attribute_not_exists(device_code_hash)"),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return deviceCode, device, nil
+}
+
+// GetDeviceAuthorization finds the pending device flow of userCode.
+func GetDeviceAuthorization(userCode string) (*DeviceAuthorization, error) {
+	userCode = NormalizeUserCode(userCode)
+	if len(userCode) != userCodeLength {
+		return nil, ErrInvalidUserCode
+	}
+
+	queryResponse, err := sessionDB().Query(&dynamodb.QueryInput{
+		TableName:              aws.String(deviceCodeTableName),
+		IndexName:              aws.String(userCodeIndex),
+		KeyConditionExpression: aws.String("user_code = :user_code"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":user_code": {S: aws.String(userCode)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []DeviceAuthorization{}
+	if err = dynamodbattribute.UnmarshalListOfMaps(queryResponse.Items, &devices); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	for _, device := range devices {
+		if device.Status == DeviceStatusPending && device.ExpiresAt > now {
+			return &device, nil
+		}
+	}
+
+	return nil, ErrInvalidUserCode
+}
+
+// decide moves a pending device flow to status, unless it was decided or
+// expired in the meantime.
+func (device *DeviceAuthorization) decide(status, sessionId string) error {
+	values := map[string]*dynamodb.AttributeValue{
+		":status":  {S: aws.String(status)},
+		":pending": {S: aws.String(DeviceStatusPending)},
+		":now":     {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+	}
+	update := "SET #status = :status"
+	if sessionId != "" {
+		update += ", session_id = :session_id"
+		values[":session_id"] = &dynamodb.AttributeValue{S: aws.String(sessionId)}
+	}
+
+	_, err := sessionDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(deviceCodeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"device_code_hash": {S: aws.String(device.DeviceCodeHash)},
+		},
+		UpdateExpression:    aws.String(update),
+		ConditionExpression: aws.String("#status = :pending AND expires_at > :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if IsConditionalCheckFailed(err) {
+		return ErrInvalidUserCode
+	}
+	if err != nil {
+		return err
+	}
+
+	device.Status = status
+	device.SessionId = sessionId
+	return nil
+}
+
+// Approve hands the saved session to the device.
+func (device *DeviceAuthorization) Approve(sessionId string) error {
+	return device.decide(DeviceStatusApproved, sessionId)
+}
+
+// Deny tells the device the user turned it down.
+func (device *DeviceAuthorization) Deny() error {
+	return device.decide(DeviceStatusDenied, "")
+}
+
+// PollDeviceAuthorization is a device asking whether it has been approved.
+// It gets the session id once, the flow is used up by it.
+func PollDeviceAuthorization(deviceCode string) (string, error) {
+	key := map[string]*dynamodb.AttributeValue{
+		"device_code_hash": {S: aws.String(hashToken(deviceCode))},
+	}
+
+	getItemResponse, err := sessionDB().GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(deviceCodeTableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if getItemResponse.Item == nil {
+		return "", ErrExpiredToken
+	}
+
+	device := &DeviceAuthorization{}
+	if err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, device); err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	if device.ExpiresAt <= now {
+		return "", ErrExpiredToken
+	}
+
+	// Polling too often is answered with a longer interval, which the
+	// client has to keep to from then on
+	tooSoon := device.LastPolledAt > 0 && now-device.LastPolledAt < device.Interval
+	update := "SET last_polled_at = :now"
+	values := map[string]*dynamodb.AttributeValue{
+		":now": {N: aws.String(strconv.FormatInt(now, 10))},
+	}
+	if tooSoon {
+		update += ", #interval = #interval + :slow_down"
+		values[":slow_down"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(DevicePollInterval))}
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(deviceCodeTableName),
+		Key:                       key,
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeValues: values,
+	}
+	if tooSoon {
+		input.ExpressionAttributeNames = map[string]*string{"#interval": aws.String("interval")}
+	}
+	if _, err = sessionDB().UpdateItem(input); err != nil {
+		return "", err
+	}
+
+	if tooSoon {
+		return "", ErrSlowDown
+	}
+
+	switch device.Status {
+	case DeviceStatusPending:
+		return "", ErrAuthorizationPending
+	case DeviceStatusDenied:
+		return "", ErrAccessDenied
+	}
+
+	// Only one poll may collect the session
+	_, err = sessionDB().DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String(deviceCodeTableName),
+		Key:                 key,
+		ConditionExpression: aws.String("#status = :approved"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":approved": {S: aws.String(DeviceStatusApproved)},
+		},
+	})
+	if IsConditionalCheckFailed(err) {
+		return "", ErrExpiredToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return device.SessionId, nil
+}
@@ -0,0 +1,83 @@
+package oauth
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"strings"
+)
+
+var (
+	ErrBadCredentials = util.NewError("incorrect username or password", 401)
+	ErrBadCode        = util.NewError("the code is incorrect", 400)
+	ErrExpiredCode    = util.NewError("the code has expired, please request a new one", 400)
+	ErrTooManyTries   = util.NewError("too many attempts, please try again later", 429)
+
+	// ErrInvalidCode is the one answer to a code that can't be confirmed,
+	// whatever the reason, see CodeError.
+	ErrInvalidCode = util.NewError("the code is invalid or has expired", 400)
+)
+
+// CodeError maps the errors of confirming an emailed code like CognitoError,
+// except that unknown, already confirmed or disabled users get the same
+// answer as a wrong or expired code, so it doesn't tell who has an account.
+func CodeError(err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	switch aerr.Code() {
+	case cognito.ErrCodeNotAuthorizedException, cognito.ErrCodeUserNotFoundException,
+		cognito.ErrCodeCodeMismatchException, cognito.ErrCodeExpiredCodeException:
+		return ErrInvalidCode
+	}
+
+	return CognitoError(err)
+}
+
+// CognitoError maps the Cognito exceptions a caller can cause to API errors,
+// leaving anything else as it is. Unknown users look like bad credentials.
+func CognitoError(err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	switch aerr.Code() {
+	case cognito.ErrCodeNotAuthorizedException, cognito.ErrCodeUserNotFoundException:
+		return ErrBadCredentials
+	case cognito.ErrCodeCodeMismatchException:
+		return ErrBadCode
+	case cognito.ErrCodeExpiredCodeException:
+		return ErrExpiredCode
+	case cognito.ErrCodeInvalidPasswordException, cognito.ErrCodeInvalidParameterException:
+		return util.NewError(aerr.Message(), 400)
+	case cognito.ErrCodePasswordResetRequiredException:
+		return util.NewError("a password reset is required", 403)
+	case cognito.ErrCodeUserNotConfirmedException:
+		return util.NewError("the account has not been confirmed yet", 403)
+	case cognito.ErrCodeUsernameExistsException, cognito.ErrCodeAliasExistsException:
+		return util.NewError("an account with this email already exists", 409)
+	case cognito.ErrCodeUserLambdaValidationException:
+		// Our triggers' messages are meant for users, Cognito wraps them as
+		// "PreSignUp failed with error <message>."
+		message := aerr.Message()
+		if i := strings.Index(message, " failed with error "); i >= 0 {
+			message = strings.TrimSuffix(message[i+len(" failed with error "):], ".")
+		}
+		return util.NewError(message, 403)
+	case cognito.ErrCodeTooManyRequestsException, cognito.ErrCodeLimitExceededException, cognito.ErrCodeTooManyFailedAttemptsException:
+		return ErrTooManyTries
+	case cognito.ErrCodeCodeDeliveryFailureException:
+		return util.NewError("the code could not be delivered, please try again later", 502)
+	}
+
+	return err
+}
+
+// IsCognitoError reports whether err is the Cognito exception code.
+func IsCognitoError(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
@@ -7,19 +7,64 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/fatih/structs"
+	"github.com/satori/go.uuid"
 	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
-	"strings"
 	"time"
 )
 
+const (
+	// sessionTableName is keyed by session_id. It replaces cognito_sessions,
+	// whose key can't be changed in place, so sessions from before it are
+	// simply signed out.
+	sessionTableName = "cognito_user_sessions"
+
+	// accessTokenIndex and userIndex are the global secondary indexes of
+	// the sessions table.
+	accessTokenIndex = "AccessTokenIndex"
+	userIndex        = "UserIndex"
+)
+
+// The ways a session can be signed in with.
+const (
+	ProviderHostedUI  = "hosted_ui"
+	ProviderPassword  = "password"
+	ProviderMagicLink = "magic_link"
+	ProviderDevice    = "device"
+)
+
+var ErrSessionNotFound = util.NewError("session not found", 401)
+
+// ClientContext describes the HTTP request behind an invocation, as passed
+// on by the API Gateway mapping templates.
+type ClientContext struct {
+	UserAgent string `json:"user_agent"`
+	SourceIP  string `json:"source_ip"`
+	Cookie    string `json:"cookie"`
+	CSRFToken string `json:"csrf_token"`
+}
+
 type CognitoSession struct {
+	SessionId    string    `json:"session_id"`
 	User         string    `json:"user"`
 	AccessToken  string    `json:"access_token"`
+	IdToken      string    `json:"id_token,omitempty"`
 	TokenType    string    `json:"token_type"`
 	RefreshToken string    `json:"refresh_token"`
 	Expiry       time.Time `json:"expiry"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastUsed     time.Time `json:"last_used"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	SourceIP     string    `json:"source_ip,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	// RefreshCredentialIssued is set once the session's refresh credential
+	// family has been started.
+	RefreshCredentialIssued bool `json:"refresh_credential_issued,omitempty"`
+	// CookieHash is the hash of the secret in the session cookie, if the
+	// session was handed to a browser.
+	CookieHash string `json:"cookie_hash,omitempty"`
 }
 
 func NewCognitoConfig() (*oauth2.Config, error) {
@@ -49,18 +94,32 @@ func NewCognitoConfig() (*oauth2.Config, error) {
 	return config, nil
 }
 
-func (cognitoSession CognitoSession) SaveSession() error {
+// SaveSession stores the session, giving new ones their id and timestamps.
+func (cognitoSession *CognitoSession) SaveSession() error {
+	now := time.Now().UTC()
+	if cognitoSession.SessionId == "" {
+		cognitoSession.SessionId = uuid.NewV4().String()
+	}
+	if cognitoSession.CreatedAt.IsZero() {
+		cognitoSession.CreatedAt = now
+	}
+	if cognitoSession.LastUsed.IsZero() {
+		cognitoSession.LastUsed = now
+	}
+
 	item, err := dynamodbattribute.MarshalMap(cognitoSession)
+	if err != nil {
+		return err
+	}
 
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 
 	db := dynamodb.New(sess)
-	tableName := "cognito_sessions"
 	_, err = db.PutItem(&dynamodb.PutItemInput{
 		Item:     item,
-		TableName: &tableName,
+		TableName: aws.String(sessionTableName),
 	})
 
 	if err != nil {
@@ -71,48 +130,21 @@ func (cognitoSession CognitoSession) SaveSession() error {
 }
 
 func GetOauthTokenSource(ctx context.Context, bearerToken string) (oauth2.TokenSource, error) {
-	// Setup structured logging
-	logger, _ := zap.NewProduction()
-	defer logger.Sync()
-	log := logger.Sugar()
-
-	accessToken := bearerToken
-	if strings.HasPrefix(bearerToken, "Bearer ") {
-		accessToken = bearerToken[7:]
-	}
-
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	dbSvc := dynamodb.New(sess)
-
-	queryRequest := &dynamodb.QueryInput{
-		TableName: aws.String("cognito_sessions"),
-		IndexName: aws.String("AccessTokenIndex"),
-		KeyConditionExpression: aws.String("access_token = :tok"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":tok": {
-				S: &accessToken,
-			},
-		},
-	}
-
-	log.Infow("DynamoDB Query Request", "Request", structs.Map(queryRequest))
-
-	queryResponse, err := dbSvc.Query(queryRequest)
+	cognitoSession, err := GetSession(bearerToken)
 	if err != nil {
-		log.Errorw("DynamoDB Query Error", "Error", structs.Map(err))
 		return nil, err
 	}
 
-	log.Infow("DynamoDB Query Response", "Response", structs.Map(queryResponse))
+	return cognitoSession.TokenSource(ctx)
+}
 
-	cognitoSession := &CognitoSession{}
-	err = dynamodbattribute.UnmarshalMap(queryResponse.Items[0], cognitoSession)
-	if err != nil {
-		return nil, err
-	}
+// TokenSource returns a token source for the session, saving the access
+// token back whenever it had to be refreshed.
+func (cognitoSession *CognitoSession) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
 
 	token := &oauth2.Token{
 		AccessToken:  cognitoSession.AccessToken,
@@ -136,8 +168,12 @@ func GetOauthTokenSource(ctx context.Context, bearerToken string) (oauth2.TokenS
 
 	if newTok.AccessToken != token.AccessToken {
 		cognitoSession.AccessToken = newTok.AccessToken
+		cognitoSession.TokenType = newTok.TokenType
 		cognitoSession.Expiry = newTok.Expiry
-		err = cognitoSession.SaveSession()
+		if idToken := idToken(newTok); idToken != "" {
+			cognitoSession.IdToken = idToken
+		}
+		err = cognitoSession.updateTokens()
 		if err != nil {
 			return nil, err
 		}
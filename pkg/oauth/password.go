@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	cognito "github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+)
+
+var (
+	passwordPolicyOnce sync.Once
+	passwordPolicy     = util.DefaultPasswordPolicy
+)
+
+// GetPasswordPolicy returns the user pool's password policy, read once per
+// container. Should the pool not be readable, Cognito's default policy is
+// checked instead, Cognito still enforces the real one.
+func GetPasswordPolicy() util.PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		// Setup structured logging
+		logger, _ := zap.NewProduction()
+		defer logger.Sync()
+		log := logger.Sugar()
+
+		issuer, err := ssm.GetIssuer()
+		if err != nil {
+			log.Errorw("unable to read the issuer, using the default password policy", "Error", err)
+			return
+		}
+
+		describeUserPoolRequest := &cognito.DescribeUserPoolInput{
+			UserPoolId: aws.String(issuer[strings.LastIndex(issuer, "/")+1:]),
+		}
+
+		log.Infow("Cognito DescribeUserPool Request", "Request", structs.Map(describeUserPoolRequest))
+
+		describeUserPoolResponse, err := NewCognitoClient().DescribeUserPool(describeUserPoolRequest)
+		if err != nil {
+			log.Errorw("Cognito DescribeUserPool Error, using the default password policy", "Error", err)
+			return
+		}
+
+		policies := describeUserPoolResponse.UserPool.Policies
+		if policies == nil || policies.PasswordPolicy == nil {
+			return
+		}
+
+		policy := policies.PasswordPolicy
+		passwordPolicy = util.PasswordPolicy{
+			MinimumLength:    int(aws.Int64Value(policy.MinimumLength)),
+			RequireUppercase: aws.BoolValue(policy.RequireUppercase),
+			RequireLowercase: aws.BoolValue(policy.RequireLowercase),
+			RequireNumbers:   aws.BoolValue(policy.RequireNumbers),
+			RequireSymbols:   aws.BoolValue(policy.RequireSymbols),
+		}
+
+		log.Infow("Cognito DescribeUserPool Response", "PasswordPolicy", passwordPolicy)
+	})
+
+	return passwordPolicy
+}
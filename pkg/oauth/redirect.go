@@ -0,0 +1,157 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	ErrInvalidRedirectURI = util.NewError("redirect_uri is not allowed", 400)
+	ErrInvalidLogoutURI   = util.NewError("logout_uri is not allowed", 400)
+)
+
+// MatchURI reports whether uri is on the allowed list. Entries match
+// exactly, unless they contain a *, which stands for a single host label or
+// path segment, as in https://*.preview.awsci.io/callback. Scheme, port and
+// query always have to be the same.
+func MatchURI(uri string, allowed []string) bool {
+	target, err := url.Parse(uri)
+	if err != nil || !target.IsAbs() || target.Host == "" || target.User != nil ||
+		target.Fragment != "" || strings.Contains(uri, "\\") {
+		return false
+	}
+
+	for _, entry := range allowed {
+		if !strings.Contains(entry, "*") {
+			if uri == entry {
+				return true
+			}
+			continue
+		}
+
+		pattern, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+
+		if pattern.Scheme == target.Scheme &&
+			pattern.Port() == target.Port() &&
+			pattern.RawQuery == target.RawQuery &&
+			matchHost(pattern.Hostname(), target.Hostname()) &&
+			matchPath(pattern.EscapedPath(), target.EscapedPath()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchHost(pattern, host string) bool {
+	patternLabels := strings.Split(strings.ToLower(pattern), ".")
+	hostLabels := strings.Split(strings.ToLower(host), ".")
+	if len(patternLabels) != len(hostLabels) {
+		return false
+	}
+
+	for i, label := range patternLabels {
+		if ok, err := path.Match(label, hostLabels[i]); err != nil || !ok || hostLabels[i] == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPath matches segment by segment, path.Match's * never crosses a /.
+// Segments are decoded before looking for dot segments, servers treat
+// %2e%2e as .. too, and encoded separators aren't allowed at all.
+func matchPath(pattern, uriPath string) bool {
+	for _, segment := range strings.Split(uriPath, "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil || decoded == "." || decoded == ".." || strings.ContainsAny(decoded, "/\\") {
+			return false
+		}
+	}
+
+	ok, err := path.Match(pattern, uriPath)
+	return err == nil && ok
+}
+
+// CheckRedirectURI fails unless the app client named client, or the web
+// client without a name, may send its users to uri after signing in.
+func CheckRedirectURI(uri, client string) error {
+	allowlist, err := ssm.GetAllowlist(client)
+	if err != nil {
+		return err
+	}
+	if !MatchURI(uri, allowlist.AllowedRedirectURIs()) {
+		return ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// CheckLogoutURI fails unless the app client named client, or the web
+// client without a name, may send its users to uri after signing out.
+func CheckLogoutURI(uri, client string) error {
+	allowlist, err := ssm.GetAllowlist(client)
+	if err != nil {
+		return err
+	}
+	if !MatchURI(uri, allowlist.LogoutURIs) {
+		return ErrInvalidLogoutURI
+	}
+	return nil
+}
+
+const hostedLogoutURL = "https://auth.awsci.io/logout"
+
+// authState travels through the hosted UI as the state parameter, so the
+// client can be sent back where it started once signed in. Cognito itself
+// only ever redirects to the app client's callback URL. Signing out works
+// the same way, with the state carried by the client.
+type authState struct {
+	Nonce       string `json:"nonce,omitempty"`
+	RedirectURI string `json:"redirect_uri"`
+	Client      string `json:"client,omitempty"`
+}
+
+// NewAuthState encodes the client's own state nonce with the redirect URI
+// and the name of the app client whose allowlist it was checked against.
+func NewAuthState(nonce, redirectURI, client string) (string, error) {
+	encoded, err := json.Marshal(authState{Nonce: nonce, RedirectURI: redirectURI, Client: client})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// ParseAuthState decodes a state made by NewAuthState. The redirect URI
+// comes back from the browser, it has to be checked again before use.
+func ParseAuthState(state string) (nonce, redirectURI, client string, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil {
+		return "", "", "", util.NewError("state is invalid", 400)
+	}
+
+	s := authState{}
+	if err = json.Unmarshal(decoded, &s); err != nil {
+		return "", "", "", util.NewError("state is invalid", 400)
+	}
+
+	return s.Nonce, s.RedirectURI, s.Client, nil
+}
+
+// HostedLogoutURL signs the user out of the hosted UI too, before sending
+// them on to logoutURI, which has to be the app client's registered sign
+// out URL.
+func HostedLogoutURL(clientId, logoutURI string) string {
+	query := url.Values{}
+	query.Set("client_id", clientId)
+	query.Set("logout_uri", logoutURI)
+	return hostedLogoutURL + "?" + query.Encode()
+}
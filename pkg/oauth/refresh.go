@@ -0,0 +1,236 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"time"
+)
+
+const (
+	refreshCredentialTableName = "refresh_credentials"
+
+	// refreshCredentialValidity matches the refresh token validity of the
+	// web client, a credential can't outlive the token behind it.
+	refreshCredentialValidity = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshCredential = util.NewError("refresh credential is invalid or has expired", 401)
+	ErrRefreshCredentialReused  = util.NewError("refresh credential has already been used, the session has been signed out", 401)
+	ErrRefreshCredentialIssued  = util.NewError("refresh_credential is required", 400)
+)
+
+// RefreshCredential is the stored half of a refresh credential we hand out
+// instead of the Cognito refresh token. Only its hash is kept. Every
+// credential of a session belongs to the same family, the session id, and
+// points at the credential it replaced.
+type RefreshCredential struct {
+	CredentialHash string    `json:"credential_hash"`
+	FamilyId       string    `json:"family_id"`
+	ParentHash     string    `json:"parent_hash,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	// RotatedAt is a pointer, dynamodbattribute doesn't omit a zero time
+	// and rotation is conditional on the attribute not existing.
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	// ExpiresAt is an epoch timestamp, the table's TTL attribute.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func hashRefreshCredential(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefreshCredential starts or continues the credential family of the
+// session, returning the credential to hand to the client.
+func IssueRefreshCredential(sessionId, parentHash string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	credential := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now().UTC()
+	item, err := dynamodbattribute.MarshalMap(RefreshCredential{
+		CredentialHash: hashRefreshCredential(credential),
+		FamilyId:       sessionId,
+		ParentHash:     parentHash,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(refreshCredentialValidity).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = sessionDB().PutItem(&dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(refreshCredentialTableName),
+		ConditionExpression: aws.String("attribute_not_exists(credential_hash)"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return credential, nil
+}
+
+// CheckRefreshCredential returns the session the credential belongs to. The
+// credential isn't used up, RotateRefreshCredential does that once the
+// session has been refreshed, so a failed refresh can be retried with it.
+// Presenting a credential that was already rotated means it leaked, so the
+// whole family is signed out.
+func CheckRefreshCredential(ctx context.Context, credential string, client ClientContext) (*CognitoSession, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	getItemResponse, err := sessionDB().GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(refreshCredentialTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"credential_hash": {S: aws.String(hashRefreshCredential(credential))},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		log.Errorw("DynamoDB GetItem Error", "Error", err)
+		return nil, err
+	}
+
+	if getItemResponse.Item == nil {
+		return nil, ErrInvalidRefreshCredential
+	}
+
+	stored := &RefreshCredential{}
+	if err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, stored); err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() >= stored.ExpiresAt {
+		return nil, ErrInvalidRefreshCredential
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, refreshCredentialReused(ctx, log, stored.FamilyId, client)
+	}
+
+	return GetSessionById(stored.FamilyId)
+}
+
+// RotateRefreshCredential uses up the credential of cognitoSession and
+// issues its successor.
+func RotateRefreshCredential(ctx context.Context, credential string, cognitoSession *CognitoSession, client ClientContext) (string, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	hash := hashRefreshCredential(credential)
+	rotatedAt, _ := dynamodbattribute.Marshal(time.Now().UTC())
+
+	// Marking it used and checking it wasn't already used happen in one step, so two
+	// concurrent uses can't both succeed
+	_, err := sessionDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(refreshCredentialTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"credential_hash": {S: aws.String(hash)},
+		},
+		UpdateExpression:    aws.String("SET rotated_at = :now"),
+		ConditionExpression: aws.String("attribute_exists(credential_hash) AND attribute_not_exists(rotated_at)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": rotatedAt,
+		},
+	})
+	if IsConditionalCheckFailed(err) {
+		return "", refreshCredentialReused(ctx, log, cognitoSession.SessionId, client)
+	}
+	if err != nil {
+		log.Errorw("DynamoDB UpdateItem Error", "Error", err)
+		return "", err
+	}
+
+	next, err := IssueRefreshCredential(cognitoSession.SessionId, hash)
+	if err != nil {
+		log.Errorw("unable to issue refresh credential", "Error", err)
+		return "", err
+	}
+
+	return next, nil
+}
+
+// refreshCredentialReused signs out the family of a credential presented
+// after it was rotated and records the security event.
+func refreshCredentialReused(ctx context.Context, log *zap.SugaredLogger, familyId string, client ClientContext) error {
+	event := SecurityEvent{
+		Type:      SecurityEventRefreshReuse,
+		SessionId: familyId,
+		UserAgent: client.UserAgent,
+		SourceIP:  client.SourceIP,
+		Detail:    "rotated refresh credential presented again, family revoked",
+	}
+	if reused, err := GetSessionById(familyId); err == nil {
+		event.User = reused.User
+	}
+
+	revokeErr := RevokeFamily(ctx, familyId)
+	LogSecurityEvent(event)
+	if revokeErr != nil {
+		log.Errorw("unable to revoke credential family", "FamilyId", familyId, "Error", revokeErr)
+	}
+
+	return ErrRefreshCredentialReused
+}
+
+// RevokeFamily signs out the session behind a credential family. Its
+// remaining credentials are useless without it and expire on their own.
+func RevokeFamily(ctx context.Context, familyId string) error {
+	cognitoSession, err := GetSessionById(familyId)
+	if err == ErrSessionNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return cognitoSession.Revoke(ctx)
+}
+
+// Refresh gets a new access token from Cognito with the session's refresh
+// token and saves it.
+func (cognitoSession *CognitoSession) Refresh(ctx context.Context) (*oauth2.Token, error) {
+	config, err := NewCognitoConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// An expired token makes the token source go to Cognito
+	token, err := config.TokenSource(ctx, &oauth2.Token{
+		RefreshToken: cognitoSession.RefreshToken,
+		Expiry:       time.Unix(1, 0),
+	}).Token()
+	if err != nil {
+		return nil, err
+	}
+
+	cognitoSession.AccessToken = token.AccessToken
+	cognitoSession.TokenType = token.TokenType
+	cognitoSession.Expiry = token.Expiry
+	if idToken := idToken(token); idToken != "" {
+		cognitoSession.IdToken = idToken
+	}
+
+	if err = cognitoSession.updateTokens(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"time"
+)
+
+const securityEventTableName = "security_events"
+
+const SecurityEventRefreshReuse = "refresh_credential_reuse"
+
+// SecurityEvent records something suspicious for later investigation.
+type SecurityEvent struct {
+	EventId   string    `json:"event_id"`
+	Type      string    `json:"type"`
+	User      string    `json:"user,omitempty"`
+	SessionId string    `json:"session_id,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LogSecurityEvent writes the event to the log and the security events
+// table. It never fails, the caller is already dealing with the problem.
+func LogSecurityEvent(event SecurityEvent) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	if event.EventId == "" {
+		event.EventId = uuid.NewV4().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	log.Warnw("security event", "SecurityEvent", event)
+
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err == nil {
+		_, err = sessionDB().PutItem(&dynamodb.PutItemInput{
+			Item:      item,
+			TableName: aws.String(securityEventTableName),
+		})
+	}
+	if err != nil {
+		log.Errorw("unable to store security event", "EventId", event.EventId, "Error", err)
+	}
+}
+
+// IsConditionalCheckFailed reports whether a DynamoDB write was refused by
+// its condition expression.
+func IsConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
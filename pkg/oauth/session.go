@@ -0,0 +1,291 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/ssm"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const revokeURL = "https://auth.awsci.io/oauth2/revoke"
+
+func sessionDB() *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return dynamodb.New(sess)
+}
+
+// GetSession returns the session the bearer token belongs to and records
+// that it has been used.
+func GetSession(bearerToken string) (*CognitoSession, error) {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	accessToken := strings.TrimPrefix(bearerToken, "Bearer ")
+	if accessToken == "" {
+		return nil, ErrSessionNotFound
+	}
+
+	queryRequest := &dynamodb.QueryInput{
+		TableName:              aws.String(sessionTableName),
+		IndexName:              aws.String(accessTokenIndex),
+		KeyConditionExpression: aws.String("access_token = :tok"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tok": {S: aws.String(accessToken)},
+		},
+	}
+
+	log.Infow("DynamoDB Query Request", "Index", accessTokenIndex)
+
+	db := sessionDB()
+
+	queryResponse, err := db.Query(queryRequest)
+	if err != nil {
+		log.Errorw("DynamoDB Query Error", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("DynamoDB Query Response", "Count", queryResponse.Count)
+
+	if len(queryResponse.Items) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	cognitoSession := &CognitoSession{}
+	err = dynamodbattribute.UnmarshalMap(queryResponse.Items[0], cognitoSession)
+	if err != nil {
+		return nil, err
+	}
+
+	cognitoSession.LastUsed = time.Now().UTC()
+	lastUsed, _ := dynamodbattribute.Marshal(cognitoSession.LastUsed)
+
+	// Only bookkeeping, a failure mustn't fail the request
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(sessionTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"session_id": {S: aws.String(cognitoSession.SessionId)},
+		},
+		UpdateExpression: aws.String("SET last_used = :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": lastUsed,
+		},
+	})
+	if err != nil {
+		log.Errorw("DynamoDB UpdateItem Error", "Error", err)
+	}
+
+	return cognitoSession, nil
+}
+
+// ListSessions returns every session of user.
+func ListSessions(user string) ([]CognitoSession, error) {
+	sessions := []CognitoSession{}
+
+	var err error
+	queryErr := sessionDB().QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(sessionTableName),
+		IndexName:              aws.String(userIndex),
+		KeyConditionExpression: aws.String("#user = :user"),
+		ExpressionAttributeNames: map[string]*string{
+			"#user": aws.String("user"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":user": {S: aws.String(user)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items := []CognitoSession{}
+		if err = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return false
+		}
+		sessions = append(sessions, items...)
+		return true
+	})
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	return sessions, err
+}
+
+// RevokeRefreshToken revokes the refresh token, and with it every access
+// token issued from it, at the user pool's revocation endpoint.
+func RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	info, err := ssm.GetClientInfo()
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("client_id", *info.ClientID)
+
+	request, err := http.NewRequest(http.MethodPost, revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		log.Errorw("Cognito Revoke Error", "Error", err)
+		return err
+	}
+	defer response.Body.Close()
+
+	log.Infow("Cognito Revoke Response", "Status", response.Status)
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("token revocation failed: %s", response.Status)
+	}
+
+	return nil
+}
+
+// Revoke signs the session out: its refresh token is revoked and the
+// session deleted.
+func (cognitoSession CognitoSession) Revoke(ctx context.Context) error {
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	if cognitoSession.RefreshToken != "" {
+		if err := RevokeRefreshToken(ctx, cognitoSession.RefreshToken); err != nil {
+			return err
+		}
+	}
+
+	deleteItemRequest := &dynamodb.DeleteItemInput{
+		TableName: aws.String(sessionTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"session_id": {S: aws.String(cognitoSession.SessionId)},
+		},
+	}
+
+	log.Infow("DynamoDB DeleteItem Request", "Request", structs.Map(deleteItemRequest))
+
+	_, err := sessionDB().DeleteItem(deleteItemRequest)
+	if err != nil {
+		log.Errorw("DynamoDB DeleteItem Error", "Error", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSessionById returns the session, or ErrSessionNotFound once it has been
+// signed out.
+func GetSessionById(sessionId string) (*CognitoSession, error) {
+	getItemResponse, err := sessionDB().GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(sessionTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"session_id": {S: aws.String(sessionId)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if getItemResponse.Item == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	cognitoSession := &CognitoSession{}
+	err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, cognitoSession)
+	if err != nil {
+		return nil, err
+	}
+
+	return cognitoSession, nil
+}
+
+// updateTokens saves the session's tokens after a refresh. Only they are
+// written, so a session signed out meanwhile isn't brought back and fields
+// written by other requests aren't overwritten.
+func (cognitoSession *CognitoSession) updateTokens() error {
+	cognitoSession.LastUsed = time.Now().UTC()
+
+	expiry, err := dynamodbattribute.Marshal(cognitoSession.Expiry)
+	if err != nil {
+		return err
+	}
+	lastUsed, err := dynamodbattribute.Marshal(cognitoSession.LastUsed)
+	if err != nil {
+		return err
+	}
+
+	updateExpression := "SET access_token = :access, token_type = :type, expiry = :expiry, last_used = :now"
+	values := map[string]*dynamodb.AttributeValue{
+		":access": {S: aws.String(cognitoSession.AccessToken)},
+		":type":   {S: aws.String(cognitoSession.TokenType)},
+		":expiry": expiry,
+		":now":    lastUsed,
+	}
+	if cognitoSession.IdToken != "" {
+		updateExpression += ", id_token = :id"
+		values[":id"] = &dynamodb.AttributeValue{S: aws.String(cognitoSession.IdToken)}
+	}
+
+	_, err = sessionDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(sessionTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"session_id": {S: aws.String(cognitoSession.SessionId)},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String("attribute_exists(session_id)"),
+		ExpressionAttributeValues: values,
+	})
+	if IsConditionalCheckFailed(err) {
+		return ErrSessionNotFound
+	}
+
+	return err
+}
+
+// markRefreshCredentialIssued records that the session's credential family
+// has been started, failing if it already was so only one request can
+// start it.
+func (cognitoSession *CognitoSession) markRefreshCredentialIssued() error {
+	_, err := sessionDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(sessionTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"session_id": {S: aws.String(cognitoSession.SessionId)},
+		},
+		UpdateExpression: aws.String("SET refresh_credential_issued = :issued"),
+		ConditionExpression: aws.String("attribute_exists(session_id) AND " +
+			"(attribute_not_exists(refresh_credential_issued) OR refresh_credential_issued = :not_issued)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":issued":     {BOOL: aws.Bool(true)},
+			":not_issued": {BOOL: aws.Bool(false)},
+		},
+	})
+	if IsConditionalCheckFailed(err) {
+		return ErrRefreshCredentialIssued
+	}
+	if err != nil {
+		return err
+	}
+
+	cognitoSession.RefreshCredentialIssued = true
+	return nil
+}
@@ -0,0 +1,132 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"go.smartmachine.io/awsci-api/pkg/util"
+	"golang.org/x/oauth2"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GrantTypeRefreshToken is the only grant the refresh endpoint takes.
+const GrantTypeRefreshToken = "refresh_token"
+
+var ErrUnsupportedGrantType = util.NewError("unsupported_grant_type", 400)
+
+// TokenResponse is the successful access token response of RFC 6749
+// section 5.1. RefreshToken carries the session's refresh credential, never
+// the Cognito refresh token.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// TokenResponse describes the session's current tokens, along with the
+// refresh credential if one was just issued.
+func (cognitoSession *CognitoSession) TokenResponse(refreshCredential string) *TokenResponse {
+	tokenType := cognitoSession.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+
+	response := &TokenResponse{
+		AccessToken:  cognitoSession.AccessToken,
+		TokenType:    tokenType,
+		IdToken:      cognitoSession.IdToken,
+		Scope:        tokenScope(cognitoSession.AccessToken),
+		RefreshToken: refreshCredential,
+	}
+
+	if expiresIn := int64(time.Until(cognitoSession.Expiry).Seconds()); expiresIn > 0 {
+		response.ExpiresIn = expiresIn
+	}
+
+	return response
+}
+
+// tokenScope reads the scope claim of a Cognito access token. The token came
+// straight from Cognito, so its signature isn't checked.
+func tokenScope(accessToken string) string {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	claims := struct {
+		Scope string `json:"scope"`
+	}{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	return claims.Scope
+}
+
+// idToken returns the ID token Cognito sent along with token, if any.
+func idToken(token *oauth2.Token) string {
+	if idToken, ok := token.Extra("id_token").(string); ok {
+		return idToken
+	}
+	return ""
+}
+
+// ParseRefreshForm reads an application/x-www-form-urlencoded refresh
+// request, returning the refresh credential it carries.
+func ParseRefreshForm(body string) (string, error) {
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return "", util.NewError("invalid_request", 400)
+	}
+
+	if form.Get("grant_type") != GrantTypeRefreshToken {
+		return "", ErrUnsupportedGrantType
+	}
+
+	return form.Get("refresh_token"), nil
+}
+
+// IssueSession saves a newly signed in session and starts its refresh
+// credential family, returning the first credential.
+func (cognitoSession *CognitoSession) IssueSession() (string, error) {
+	if err := cognitoSession.SaveSession(); err != nil {
+		return "", err
+	}
+
+	return cognitoSession.StartRefreshFamily()
+}
+
+// StartRefreshFamily starts the refresh credential family of a session
+// that doesn't have one yet, returning the first credential.
+func (cognitoSession *CognitoSession) StartRefreshFamily() (string, error) {
+	if err := cognitoSession.markRefreshCredentialIssued(); err != nil {
+		return "", err
+	}
+
+	return IssueRefreshCredential(cognitoSession.SessionId, "")
+}
+
+// ParseDeviceTokenForm reads an application/x-www-form-urlencoded device
+// access token request, RFC 8628 section 3.4, returning the device code.
+func ParseDeviceTokenForm(body string) (string, error) {
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return "", util.NewError("invalid_request", 400)
+	}
+
+	if form.Get("grant_type") != GrantTypeDeviceCode {
+		return "", ErrUnsupportedGrantType
+	}
+
+	return form.Get("device_code"), nil
+}
@@ -6,12 +6,56 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/fatih/structs"
+	"go.smartmachine.io/awsci-api/pkg/util"
 	"go.uber.org/zap"
+	"strings"
+)
+
+const (
+	ClientIDParameter    = "/cognito/client/id"
+	CallbackURLParameter = "/cognito/client/callbackUrl"
+	AuthDomainParameter  = "/cognito/authDomain"
+	IssuerParameter      = "/cognito/issuer"
+
+	// RedirectURIsParameter and LogoutURIsParameter hold comma separated
+	// lists of the URIs clients may be sent to after signing in and out.
+	RedirectURIsParameter = "/cognito/client/redirectUris"
+	LogoutURIsParameter   = "/cognito/client/logoutUris"
+
+	// LogoutURLParameter is the sign out URL registered on the app client,
+	// the only place the hosted UI sends users after signing out.
+	LogoutURLParameter = "/cognito/client/logoutUrl"
+
+	AllowedDomainsParameter = "/cognito/signup/allowedDomains"
 )
 
 type ClientInfo struct{
-	ClientID    *string `json:"client_id"`
-	CallbackURL *string `json:"callback_url"`
+	ClientID     *string  `json:"client_id"`
+	CallbackURL  *string  `json:"callback_url"`
+	RedirectURIs []string `json:"redirect_uris"`
+	LogoutURIs   []string `json:"logout_uris"`
+	LogoutURL    *string  `json:"logout_url,omitempty"`
+}
+
+// AllowedRedirectURIs is RedirectURIs along with the app client's callback
+// URL, which is always allowed.
+func (info *ClientInfo) AllowedRedirectURIs() []string {
+	allowed := []string{}
+	if info.CallbackURL != nil && *info.CallbackURL != "" {
+		allowed = append(allowed, *info.CallbackURL)
+	}
+	return append(allowed, info.RedirectURIs...)
+}
+
+// splitList parses a comma separated parameter value.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
 
 func GetClientInfo() (*ClientInfo, error) {
@@ -29,8 +73,11 @@ func GetClientInfo() (*ClientInfo, error) {
 
 	getParametersRequest := &ssm.GetParametersInput{
 		Names:          []*string{
-			aws.String("/cognito/client/id"),
-			aws.String("/cognito/client/callbackUrl"),
+			aws.String(ClientIDParameter),
+			aws.String(CallbackURLParameter),
+			aws.String(RedirectURIsParameter),
+			aws.String(LogoutURIsParameter),
+			aws.String(LogoutURLParameter),
 		},
 		WithDecryption: aws.Bool(false),
 	}
@@ -45,14 +92,20 @@ func GetClientInfo() (*ClientInfo, error) {
 
 	log.Infow("SSM GetParameters Response", "Response", structs.Map(getParametersResponse))
 
-	info := &ClientInfo{}
+	info := &ClientInfo{RedirectURIs: []string{}, LogoutURIs: []string{}}
 
 	for _, param := range getParametersResponse.Parameters {
 		switch *param.Name {
-		case "/cognito/client/id":
+		case ClientIDParameter:
 			info.ClientID = param.Value
-		case "/cognito/client/callbackUrl":
+		case CallbackURLParameter:
 			info.CallbackURL = param.Value
+		case RedirectURIsParameter:
+			info.RedirectURIs = splitList(*param.Value)
+		case LogoutURIsParameter:
+			info.LogoutURIs = splitList(*param.Value)
+		case LogoutURLParameter:
+			info.LogoutURL = param.Value
 		}
 	}
 
@@ -63,3 +116,151 @@ func GetClientInfo() (*ClientInfo, error) {
 
 	return info, nil
 }
+
+type SignUpConfig struct {
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// GetSignUpConfig returns the self-registration settings. A missing
+// parameter means nobody may sign up without an invitation.
+func GetSignUpConfig() (*SignUpConfig, error) {
+
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	ssmSvc := ssm.New(sess)
+
+	getParametersRequest := &ssm.GetParametersInput{
+		Names: []*string{
+			aws.String(AllowedDomainsParameter),
+		},
+		WithDecryption: aws.Bool(false),
+	}
+
+	log.Infow("SSM GetParameters Request", "Request", structs.Map(getParametersRequest))
+
+	getParametersResponse, err := ssmSvc.GetParameters(getParametersRequest)
+	if err != nil {
+		log.Errorw("SSM GetParameters Error", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("SSM GetParameters Response", "Response", structs.Map(getParametersResponse))
+
+	config := &SignUpConfig{AllowedDomains: []string{}}
+
+	for _, param := range getParametersResponse.Parameters {
+		switch *param.Name {
+		case AllowedDomainsParameter:
+			for _, domain := range strings.Split(*param.Value, ",") {
+				if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+					config.AllowedDomains = append(config.AllowedDomains, domain)
+				}
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// GetIssuer returns the issuer of the user pool's tokens,
+// https://cognito-idp.<region>.amazonaws.com/<user pool id>.
+func GetIssuer() (string, error) {
+
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	ssmSvc := ssm.New(sess)
+
+	getParameterRequest := &ssm.GetParameterInput{
+		Name:           aws.String(IssuerParameter),
+		WithDecryption: aws.Bool(false),
+	}
+
+	log.Infow("SSM GetParameter Request", "Request", structs.Map(getParameterRequest))
+
+	getParameterResponse, err := ssmSvc.GetParameter(getParameterRequest)
+	if err != nil {
+		log.Errorw("SSM GetParameter Error", "Error", err)
+		return "", err
+	}
+
+	log.Infow("SSM GetParameter Response", "Response", structs.Map(getParameterResponse))
+
+	return aws.StringValue(getParameterResponse.Parameter.Value), nil
+}
+
+// GetAllowlist returns where the API may send the users of the app client
+// named client after signing in and out, as published by its
+// Custom::CognitoAppClients resource. Without a name the allowlists of the
+// web client are returned.
+func GetAllowlist(client string) (*ClientInfo, error) {
+	if client == "" {
+		return GetClientInfo()
+	}
+
+	// Setup structured logging
+	logger, _ := zap.NewProduction()
+	defer logger.Sync()
+	log := logger.Sugar()
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	ssmSvc := ssm.New(sess)
+
+	prefix := "/cognito/clients/" + client + "/"
+
+	getParametersRequest := &ssm.GetParametersInput{
+		Names: []*string{
+			aws.String(prefix + "id"),
+			aws.String(prefix + "redirectUris"),
+			aws.String(prefix + "logoutUris"),
+		},
+		WithDecryption: aws.Bool(false),
+	}
+
+	log.Infow("SSM GetParameters Request", "Request", structs.Map(getParametersRequest))
+
+	getParametersResponse, err := ssmSvc.GetParameters(getParametersRequest)
+	if err != nil {
+		log.Errorw("SSM GetParameters Error", "Error", err)
+		return nil, err
+	}
+
+	log.Infow("SSM GetParameters Response", "Response", structs.Map(getParametersResponse))
+
+	info := &ClientInfo{RedirectURIs: []string{}, LogoutURIs: []string{}}
+
+	for _, param := range getParametersResponse.Parameters {
+		switch strings.TrimPrefix(*param.Name, prefix) {
+		case "id":
+			info.ClientID = param.Value
+		case "redirectUris":
+			info.RedirectURIs = splitList(*param.Value)
+		case "logoutUris":
+			info.LogoutURIs = splitList(*param.Value)
+		}
+	}
+
+	// Unknown clients may not send anyone anywhere
+	if info.ClientID == nil {
+		log.Warnw("app client not found", "Client", client)
+		return nil, util.NewError("client is unknown", 400)
+	}
+
+	return info, nil
+}
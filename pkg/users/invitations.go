@@ -0,0 +1,89 @@
+package users
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"strconv"
+	"time"
+)
+
+const invitationsTableName = "invitations"
+
+// ErrInvalidInvitation is returned for invitations that don't exist, have
+// expired, were already used or were issued to another email.
+var ErrInvalidInvitation = errors.New("invitation invalid")
+
+// Invitation lets somebody sign up without an allowed email domain. Open
+// invitations have no Email and may be used from any address.
+type Invitation struct {
+	Code      string `json:"code"`
+	Email     string `json:"email,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedBy    string `json:"used_by,omitempty"`
+	UsedAt    string `json:"used_at,omitempty"`
+}
+
+// GetInvitation returns the invitation code if email may still sign up with
+// it, or ErrInvalidInvitation. The invitation isn't used up, that is left to
+// RedeemInvitation once the user exists.
+func GetInvitation(code, email string) (*Invitation, error) {
+	getItemResponse, err := dynamoDB().GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(invitationsTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(code)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if getItemResponse.Item == nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation := &Invitation{}
+	err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation.UsedAt != "" || invitation.ExpiresAt <= time.Now().Unix() ||
+		(invitation.Email != "" && invitation.Email != email) {
+		return nil, ErrInvalidInvitation
+	}
+
+	return invitation, nil
+}
+
+// RedeemInvitation marks the invitation as used by username, failing with
+// ErrInvalidInvitation if somebody else got to it first. Redeeming it again
+// for the same username succeeds, as Cognito retries triggers.
+func RedeemInvitation(code, email, username string) error {
+	now := time.Now().UTC()
+
+	_, err := dynamoDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(invitationsTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(code)},
+		},
+		UpdateExpression: aws.String("SET used_by = :user, used_at = if_not_exists(used_at, :now)"),
+		ConditionExpression: aws.String("attribute_exists(code) AND (attribute_not_exists(email) OR email = :email) " +
+			"AND ((attribute_not_exists(used_at) AND expires_at > :epoch) OR used_by = :user)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":user":  {S: aws.String(username)},
+			":now":   {S: aws.String(now.Format(time.RFC3339))},
+			":epoch": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":email": {S: aws.String(email)},
+		},
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrInvalidInvitation
+	}
+
+	return err
+}
@@ -0,0 +1,163 @@
+package users
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"time"
+)
+
+const (
+	tableName = "users"
+
+	// DefaultRole is given to every user on sign up.
+	DefaultRole = "user"
+)
+
+var ErrNotFound = errors.New("user not found")
+
+// User is the profile kept for every confirmed user of the user pool, keyed
+// by their Cognito sub.
+type User struct {
+	Sub         string            `json:"sub"`
+	Username    string            `json:"username"`
+	Email       string            `json:"email"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Roles       []string          `json:"roles"`
+	Tenant      string            `json:"tenant,omitempty"`
+	GitHub      string            `json:"github,omitempty"`
+	Preferences map[string]string `json:"preferences"`
+}
+
+func NewUser(sub, username, email string) *User {
+	return &User{
+		Sub:         sub,
+		Username:    username,
+		Email:       email,
+		CreatedAt:   time.Now().UTC(),
+		Roles:       []string{DefaultRole},
+		Preferences: map[string]string{},
+	}
+}
+
+func dynamoDB() *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return dynamodb.New(sess)
+}
+
+// GetUser returns the profile of sub, or ErrNotFound if there is none.
+func GetUser(sub string) (*User, error) {
+	getItemResponse, err := dynamoDB().GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"sub": {S: aws.String(sub)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if getItemResponse.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	user := &User{}
+	err = dynamodbattribute.UnmarshalMap(getItemResponse.Item, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateUser stores the profile unless one already exists for the same sub,
+// reporting whether it was created.
+func (user User) CreateUser() (bool, error) {
+	item, err := dynamodbattribute.MarshalMap(user)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = dynamoDB().PutItem(&dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(tableName),
+		ConditionExpression: aws.String("attribute_not_exists(sub)"),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateEmail keeps the profile's email in step with a newly verified one.
+// Users without a profile are left alone.
+func UpdateEmail(sub, email string) error {
+	_, err := dynamoDB().UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"sub": {S: aws.String(sub)},
+		},
+		UpdateExpression:    aws.String("SET email = :email"),
+		ConditionExpression: aws.String("attribute_exists(sub)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":email": {S: aws.String(email)},
+		},
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+
+	return err
+}
+
+// pendingSub keys the profiles of users created by the migration trigger,
+// which runs before Cognito has given the user a sub.
+func pendingSub(username string) string {
+	return "pending:" + username
+}
+
+// CreatePendingUser stores the profile until ClaimPendingUser moves it to the
+// user's sub, reporting whether it was created.
+func (user User) CreatePendingUser() (bool, error) {
+	user.Sub = pendingSub(user.Username)
+	return user.CreateUser()
+}
+
+// ClaimPendingUser moves the pending profile of username to sub, returning
+// it, or ErrNotFound if there is none.
+func ClaimPendingUser(sub, username string) (*User, error) {
+	user, err := GetUser(pendingSub(username))
+	if err != nil {
+		return nil, err
+	}
+
+	user.Sub = sub
+	if _, err = user.CreateUser(); err != nil {
+		return nil, err
+	}
+
+	_, err = dynamoDB().DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"sub": {S: aws.String(pendingSub(username))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetUser(sub)
+}
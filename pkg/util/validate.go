@@ -0,0 +1,102 @@
+package util
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+const maxPasswordLength = 256
+
+// NormalizeEmail trims and lower cases an email, the form usernames are
+// stored in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return NewError("email is invalid", 400)
+	}
+	return nil
+}
+
+// PasswordPolicy is the user pool's password policy, checked up front so
+// users get one clear message instead of Cognito's.
+type PasswordPolicy struct {
+	MinimumLength    int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireNumbers   bool
+	RequireSymbols   bool
+}
+
+// DefaultPasswordPolicy is the policy Cognito gives new user pools.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinimumLength:    8,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	RequireNumbers:   true,
+	RequireSymbols:   true,
+}
+
+// passwordSymbols are the characters Cognito counts as symbols.
+const passwordSymbols = "^$*.[]{}()?\"!@#%&/\\,><':;|_~`=+- "
+
+func ValidatePassword(password string, policy PasswordPolicy) error {
+	minLength := policy.MinimumLength
+	if minLength < 6 {
+		minLength = 6
+	}
+	if len(password) < minLength || len(password) > maxPasswordLength {
+		return NewError(fmt.Sprintf("password must be between %d and %d characters long", minLength, maxPasswordLength), 400)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case strings.ContainsRune(passwordSymbols, r):
+			symbol = true
+		}
+	}
+
+	missing := []string{}
+	if policy.RequireUppercase && !upper {
+		missing = append(missing, "upper case letters")
+	}
+	if policy.RequireLowercase && !lower {
+		missing = append(missing, "lower case letters")
+	}
+	if policy.RequireNumbers && !digit {
+		missing = append(missing, "digits")
+	}
+	if policy.RequireSymbols && !symbol {
+		missing = append(missing, "symbols")
+	}
+
+	if len(missing) > 0 {
+		return NewError("password must contain "+strings.Join(missing, ", "), 400)
+	}
+	return nil
+}
+
+// ValidateCode checks the six digit codes Cognito sends by email and SMS.
+func ValidateCode(code string) error {
+	if len(code) != 6 {
+		return NewError("code is invalid", 400)
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return NewError("code is invalid", 400)
+		}
+	}
+	return nil
+}